@@ -0,0 +1,48 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	stderrors "errors"
+)
+
+// Abort wraps the error returned from Func to tell Call to stop straight
+// away, without any more attempts. Call then returns err, without consulting
+// the IsFatalError or IsRetryableError, so err is the cause of the error
+// returned from Call. If err is nil, Abort returns nil.
+func Abort(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &abort{err: err}
+}
+
+type abort struct {
+	err error
+}
+
+// Error provides the implementation for the error interface method.
+func (e *abort) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the error that was wrapped.
+func (e *abort) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the error that was wrapped.
+func (e *abort) Unwrap() error {
+	return e.err
+}
+
+// aborted returns the error given to Abort, if the error is, or wraps, an
+// error returned from Abort.
+func aborted(err error) (error, bool) {
+	var a *abort
+	if !stderrors.As(err, &a) {
+		return nil, false
+	}
+	return a.err, true
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type abortSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&abortSuite{})
+
+func (*abortSuite) TestAbort(c *gc.C) {
+	clock := &mockClock{}
+	hopeless := errors.New("hopeless")
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 2 {
+				return retry.Abort(hopeless)
+			}
+			return errors.New("bah")
+		},
+		// Abort is not re-classified.
+		IsRetryableError: func(error) bool { return true },
+		Attempts:         5,
+		Delay:            time.Minute,
+		Clock:            clock,
+	})
+	c.Assert(err, gc.ErrorMatches, `hopeless`)
+	c.Assert(errors.Cause(err), gc.Equals, hopeless)
+	c.Assert(count, gc.Equals, 2)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute})
+}
+
+func (*abortSuite) TestAbortWrapped(c *gc.C) {
+	hopeless := errors.New("hopeless")
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.Annotate(retry.Abort(hopeless), "giving up")
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), gc.Equals, hopeless)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (*abortSuite) TestAbortNil(c *gc.C) {
+	c.Assert(retry.Abort(nil), gc.IsNil)
+}
+
+func (*abortSuite) TestAbortMessage(c *gc.C) {
+	err := retry.Abort(errors.New("hopeless"))
+	c.Assert(err, gc.ErrorMatches, `hopeless`)
+	c.Assert(errors.Cause(err), gc.ErrorMatches, `hopeless`)
+}
@@ -0,0 +1,39 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"sync"
+)
+
+// Go runs Call with the args in a new goroutine. The final result of the
+// Call is delivered on the returned done channel, which has a buffer of one
+// so the goroutine never blocks on it. Calling cancel behaves as if the Stop
+// channel had been closed, and it is safe to call cancel more than once. If
+// the args already have a Stop channel, closing it also stops the Call.
+func Go(args CallArgs) (cancel func(), done <-chan error) {
+	stop := make(chan struct{})
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() { close(stop) })
+	}
+	finished := make(chan struct{})
+	if args.Stop != nil {
+		callerStop := args.Stop
+		go func() {
+			select {
+			case <-callerStop:
+				cancel()
+			case <-finished:
+			}
+		}()
+	}
+	args.Stop = stop
+	result := make(chan error, 1)
+	go func() {
+		defer close(finished)
+		result <- Call(args)
+	}()
+	return cancel, result
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type asyncSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&asyncSuite{})
+
+func (*asyncSuite) waitForResult(c *gc.C, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for the result")
+	}
+	return nil
+}
+
+func (s *asyncSuite) TestGoSuccess(c *gc.C) {
+	count := 0
+	_, done := retry.Go(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count < 3 {
+				return errors.New("bah")
+			}
+			return nil
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	err := s.waitForResult(c, done)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (s *asyncSuite) TestGoAttemptsExceeded(c *gc.C) {
+	_, done := retry.Go(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	err := s.waitForResult(c, done)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+}
+
+func (s *asyncSuite) TestGoCancel(c *gc.C) {
+	started := make(chan struct{}, 1)
+	cancel, done := retry.Go(retry.CallArgs{
+		Func: func() error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			return errors.New("bah")
+		},
+		Attempts: retry.UnlimitedAttempts,
+		Delay:    time.Hour,
+	})
+	<-started
+	cancel()
+	// Cancelling more than once is fine.
+	cancel()
+	err := s.waitForResult(c, done)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
+}
+
+func (s *asyncSuite) TestGoCallerStop(c *gc.C) {
+	stop := make(chan struct{})
+	started := make(chan struct{}, 1)
+	_, done := retry.Go(retry.CallArgs{
+		Func: func() error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			return errors.New("bah")
+		},
+		Attempts: retry.UnlimitedAttempts,
+		Delay:    time.Hour,
+		Stop:     stop,
+	})
+	<-started
+	close(stop)
+	err := s.waitForResult(c, done)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// BackoffFunc is used to calculate the delay before the next retry. It is
+// passed the previous delay and the number of the attempt that just failed,
+// starting at 1.
+type BackoffFunc func(delay time.Duration, attempt int) time.Duration
+
+// ExponentialBackoff returns a BackoffFunc where the delay is `base`
+// multiplied by `factor` raised to the number of retries so far: base for
+// the first retry, base*factor for the second, base*factor^2 for the third,
+// and so on. The delay is capped at `maxDelay`. If `maxDelay` is zero, the
+// delay is not capped, other than at the largest possible time.Duration.
+func ExponentialBackoff(base time.Duration, factor float64, maxDelay time.Duration) BackoffFunc {
+	return func(_ time.Duration, attempt int) time.Duration {
+		next := float64(base) * math.Pow(factor, float64(attempt-1))
+		if next > float64(maxDelay) && maxDelay > 0 {
+			return maxDelay
+		}
+		if next >= math.MaxInt64 {
+			return math.MaxInt64
+		}
+		return time.Duration(next)
+	}
+}
+
+// FullJitterBackoff returns a BackoffFunc that implements the "full jitter"
+// algorithm. The delay is a random duration between zero and an
+// exponentially growing ceiling, which is `base` for the first retry and
+// doubles for each subsequent retry. The ceiling is capped at `maxDelay`. If
+// `maxDelay` is zero, the ceiling is not capped. The delays come from the
+// global source of randomness; use FullJitterBackoffWithRand to choose the
+// source.
+func FullJitterBackoff(base, maxDelay time.Duration) BackoffFunc {
+	return FullJitterBackoffWithRand(base, maxDelay, nil)
+}
+
+// FullJitterBackoffWithRand is like FullJitterBackoff, but the delays come
+// from `r`, which is usually the Rand of the CallArgs. If `r` is nil, the
+// global source is used.
+func FullJitterBackoffWithRand(base, maxDelay time.Duration, r *rand.Rand) BackoffFunc {
+	return func(_ time.Duration, attempt int) time.Duration {
+		ceiling := float64(base) * math.Pow(2, float64(attempt-1))
+		if ceiling > float64(maxDelay) && maxDelay > 0 {
+			ceiling = float64(maxDelay)
+		}
+		if ceiling > math.MaxInt64 {
+			ceiling = math.MaxInt64
+		}
+		return time.Duration(randomFrom(r) * ceiling)
+	}
+}
+
+// FibonacciBackoff returns a BackoffFunc where the delay grows as `base`
+// multiplied by the Fibonacci sequence: base, base, 2*base, 3*base, 5*base,
+// and so on. Use MaxDelay to cap the delay.
+func FibonacciBackoff(base time.Duration) BackoffFunc {
+	return func(_ time.Duration, attempt int) time.Duration {
+		previous, current := time.Duration(0), base
+		for i := 1; i < attempt; i++ {
+			if current > math.MaxInt64-previous {
+				return math.MaxInt64
+			}
+			previous, current = current, previous+current
+		}
+		return current
+	}
+}
+
+// DecorrelatedJitter returns a BackoffFunc that implements the "decorrelated
+// jitter" algorithm, where each delay is a random duration between `base`
+// and three times the previous delay, capped at `maxDelay`. If `maxDelay` is
+// zero, the delay is not capped. The first delay is based on the Delay of
+// the CallArgs. The delays come from the global source of randomness; use
+// DecorrelatedJitterWithRand to choose the source.
+func DecorrelatedJitter(base, maxDelay time.Duration) BackoffFunc {
+	return DecorrelatedJitterWithRand(base, maxDelay, nil)
+}
+
+// DecorrelatedJitterWithRand is like DecorrelatedJitter, but the delays come
+// from `r`, which is usually the Rand of the CallArgs. If `r` is nil, the
+// global source is used.
+func DecorrelatedJitterWithRand(base, maxDelay time.Duration, r *rand.Rand) BackoffFunc {
+	return func(delay time.Duration, _ int) time.Duration {
+		ceiling := 3 * float64(delay)
+		if ceiling < float64(base) {
+			ceiling = float64(base)
+		}
+		next := float64(base) + randomFrom(r)*(ceiling-float64(base))
+		if next > float64(maxDelay) && maxDelay > 0 {
+			next = float64(maxDelay)
+		}
+		if next > math.MaxInt64 {
+			next = math.MaxInt64
+		}
+		return time.Duration(next)
+	}
+}
+
+// RandomDelay returns a BackoffFunc where each delay is drawn uniformly
+// from `min` to `max` inclusive, regardless of the attempt number or the
+// previous delay, so there is no backoff at all. The draws come from the
+// global source of randomness; use RandomDelayWithRand to choose the source.
+// If `min` is negative or greater than `max`, RandomDelay returns a NotValid
+// error.
+func RandomDelay(min, max time.Duration) (BackoffFunc, error) {
+	return RandomDelayWithRand(min, max, nil)
+}
+
+// RandomDelayWithRand is like RandomDelay, but the delays come from `r`,
+// which is usually the Rand of the CallArgs. If `r` is nil, the global
+// source is used.
+func RandomDelayWithRand(min, max time.Duration, r *rand.Rand) (BackoffFunc, error) {
+	if min < 0 || min > max {
+		return nil, errors.NotValidf("RandomDelay from %v to %v", min, max)
+	}
+	return func(time.Duration, int) time.Duration {
+		next := float64(min) + randomFrom(r)*(float64(max-min)+1)
+		if next > float64(max) {
+			return max
+		}
+		return time.Duration(next)
+	}, nil
+}
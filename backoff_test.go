@@ -0,0 +1,332 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type backoffSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&backoffSuite{})
+
+func (*backoffSuite) TestBackoffFunc(c *gc.C) {
+	clock := &mockClock{}
+	var (
+		delays   []time.Duration
+		attempts []int
+	)
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		BackoffFunc: func(delay time.Duration, attempt int) time.Duration {
+			delays = append(delays, delay)
+			attempts = append(attempts, attempt)
+			return delay + time.Minute
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		MaxDelay: 4 * time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		3 * time.Minute,
+		4 * time.Minute,
+	})
+	c.Assert(attempts, jc.DeepEquals, []int{1, 2, 3, 4})
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		2 * time.Minute,
+		3 * time.Minute,
+		4 * time.Minute,
+		// Capped by the MaxDelay.
+		4 * time.Minute,
+	})
+}
+
+func (*backoffSuite) TestBackoffFuncWithBackoffFactorNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		BackoffFunc:   retry.FullJitterBackoff(time.Second, time.Minute),
+		BackoffFactor: 2,
+		Attempts:      5,
+		Delay:         time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `BackoffFactor of 2 with BackoffFunc not valid`)
+}
+
+func (s *backoffSuite) TestFullJitterBackoff(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.5 })
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		BackoffFunc: retry.FullJitterBackoff(time.Minute, 10*time.Minute),
+		Attempts:    7,
+		Delay:       time.Minute,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		30 * time.Second,
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		5 * time.Minute,
+		5 * time.Minute,
+	})
+}
+
+func (s *backoffSuite) TestFullJitterBackoffRange(c *gc.C) {
+	backoff := retry.FullJitterBackoff(time.Second, 0)
+	for attempt := 1; attempt < 100; attempt++ {
+		delay := backoff(0, attempt)
+		c.Check(delay >= 0, jc.IsTrue)
+	}
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0 })
+	c.Check(backoff(0, 5), gc.Equals, time.Duration(0))
+}
+
+func (*backoffSuite) TestFibonacciBackoff(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		BackoffFunc: retry.FibonacciBackoff(time.Second),
+		Attempts:    8,
+		Delay:       time.Second,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Second,
+		time.Second,
+		2 * time.Second,
+		3 * time.Second,
+		5 * time.Second,
+		8 * time.Second,
+		13 * time.Second,
+	})
+}
+
+func (*backoffSuite) TestFibonacciBackoffMaxDelay(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		BackoffFunc: retry.FibonacciBackoff(time.Second),
+		Attempts:    8,
+		Delay:       time.Second,
+		MaxDelay:    6 * time.Second,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Second,
+		time.Second,
+		2 * time.Second,
+		3 * time.Second,
+		5 * time.Second,
+		6 * time.Second,
+		6 * time.Second,
+	})
+}
+
+func (*backoffSuite) TestFibonacciBackoffOverflow(c *gc.C) {
+	backoff := retry.FibonacciBackoff(time.Hour)
+	c.Assert(backoff(0, 1000), gc.Equals, time.Duration(math.MaxInt64))
+}
+
+func (*backoffSuite) TestExponentialBackoff(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		BackoffFunc: retry.ExponentialBackoff(4*time.Second, 1.5, 20*time.Second),
+		Attempts:    7,
+		Delay:       time.Second,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		4 * time.Second,
+		6 * time.Second,
+		9 * time.Second,
+		13500 * time.Millisecond,
+		// Capped at 20 seconds.
+		20 * time.Second,
+		20 * time.Second,
+	})
+}
+
+func (*backoffSuite) TestExponentialBackoffValues(c *gc.C) {
+	for i, test := range []struct {
+		base     time.Duration
+		factor   float64
+		maxDelay time.Duration
+		attempt  int
+		expect   time.Duration
+	}{{
+		base:    time.Second,
+		factor:  2,
+		attempt: 1,
+		expect:  time.Second,
+	}, {
+		base:    time.Second,
+		factor:  2,
+		attempt: 4,
+		expect:  8 * time.Second,
+	}, {
+		base:    time.Second,
+		factor:  1,
+		attempt: 10,
+		expect:  time.Second,
+	}, {
+		base:     time.Minute,
+		factor:   2,
+		maxDelay: time.Hour,
+		attempt:  10,
+		expect:   time.Hour,
+	}, {
+		base:    time.Hour,
+		factor:  2,
+		attempt: 1000,
+		expect:  math.MaxInt64,
+	}} {
+		c.Logf("test %d", i)
+		backoff := retry.ExponentialBackoff(test.base, test.factor, test.maxDelay)
+		c.Check(backoff(0, test.attempt), gc.Equals, test.expect)
+	}
+}
+
+func (s *backoffSuite) TestDecorrelatedJitter(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.5 })
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		BackoffFunc: retry.DecorrelatedJitter(time.Second, time.Minute),
+		Attempts:    6,
+		Delay:       time.Second,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// Each delay is half way between the base and three times the
+	// previous delay.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		2 * time.Second,
+		3500 * time.Millisecond,
+		5750 * time.Millisecond,
+		9125 * time.Millisecond,
+		14187500 * time.Microsecond,
+	})
+}
+
+func (s *backoffSuite) TestDecorrelatedJitterRange(c *gc.C) {
+	backoff := retry.DecorrelatedJitter(time.Second, time.Minute)
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0 })
+	c.Check(backoff(10*time.Second, 1), gc.Equals, time.Second)
+	// The base is the lower bound even if the previous delay was smaller.
+	c.Check(backoff(time.Millisecond, 1), gc.Equals, time.Second)
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.999 })
+	c.Check(backoff(10*time.Second, 1) < 30*time.Second, jc.IsTrue)
+	c.Check(backoff(time.Hour, 1), gc.Equals, time.Minute)
+}
+
+func (s *backoffSuite) TestRandomDelay(c *gc.C) {
+	draws := []float64{0.5, 0, 0.25}
+	s.PatchValue(retry.RandFloat64, func() float64 {
+		draw := draws[0]
+		draws = draws[1:]
+		return draw
+	})
+	backoff, err := retry.RandomDelay(time.Second, 5*time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	clock := &mockClock{}
+	err = retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		BackoffFunc: backoff,
+		Attempts:    4,
+		Delay:       time.Second,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// Each delay is a fresh draw, with no backoff between them.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		3 * time.Second,
+		time.Second,
+		2 * time.Second,
+	})
+}
+
+func (s *backoffSuite) TestRandomDelayRange(c *gc.C) {
+	backoff, err := retry.RandomDelay(time.Second, time.Minute)
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0 })
+	c.Check(backoff(time.Hour, 1), gc.Equals, time.Second)
+	// The max is included in the range.
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.9999999999999999 })
+	c.Check(backoff(time.Hour, 10), gc.Equals, time.Minute)
+	// The min and max can be the same.
+	backoff, err = retry.RandomDelay(time.Second, time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(backoff(0, 1), gc.Equals, time.Second)
+}
+
+func (*backoffSuite) TestRandomDelayNotValid(c *gc.C) {
+	backoff, err := retry.RandomDelay(time.Minute, time.Second)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `RandomDelay from 1m0s to 1s not valid`)
+	c.Check(backoff, gc.IsNil)
+	_, err = retry.RandomDelayWithRand(-time.Second, time.Second, nil)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `RandomDelay from -1s to 1s not valid`)
+}
+
+func (s *backoffSuite) TestWithRand(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 {
+		c.Fatalf("global source used")
+		return 0
+	})
+	newBackoffs := map[string]func(r *rand.Rand) retry.BackoffFunc{
+		"FullJitterBackoffWithRand": func(r *rand.Rand) retry.BackoffFunc {
+			return retry.FullJitterBackoffWithRand(time.Second, time.Minute, r)
+		},
+		"DecorrelatedJitterWithRand": func(r *rand.Rand) retry.BackoffFunc {
+			return retry.DecorrelatedJitterWithRand(time.Second, time.Minute, r)
+		},
+		"RandomDelayWithRand": func(r *rand.Rand) retry.BackoffFunc {
+			backoff, err := retry.RandomDelayWithRand(time.Second, time.Minute, r)
+			c.Assert(err, jc.ErrorIsNil)
+			return backoff
+		},
+	}
+	for name, newBackoff := range newBackoffs {
+		c.Logf("%s", name)
+		// The same seed gives the same delays every time.
+		var delays [2][]time.Duration
+		for i := range delays {
+			clock := &mockClock{}
+			err := retry.Call(retry.CallArgs{
+				Func:        func() error { return errors.New("bah") },
+				BackoffFunc: newBackoff(rand.New(rand.NewSource(42))),
+				Attempts:    5,
+				Delay:       time.Second,
+				Clock:       clock,
+			})
+			c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+			delays[i] = clock.delays
+		}
+		c.Check(delays[0], gc.HasLen, 4)
+		c.Check(delays[0], jc.DeepEquals, delays[1])
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// BatchError is the error returned from an attempt of CallAll when some of
+// the functions failed, or from an attempt of CallAny when all of them
+// failed. Errors has an entry for each of the functions, in the order they
+// were passed. The entry is the last error that the function returned, or
+// nil if it has succeeded.
+type BatchError struct {
+	Errors []error
+}
+
+// Error provides the implementation for the error interface method.
+func (e *BatchError) Error() string {
+	var messages []string
+	for i, err := range e.Errors {
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("func %d: %v", i, err))
+		}
+	}
+	return fmt.Sprintf("%d of %d funcs failed: %s", len(messages), len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the errors of the functions that failed, for use by
+// errors.Is and errors.As.
+func (e *BatchError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// CallAll retries a set of functions until they have all succeeded. On
+// each attempt, only the functions that have not yet succeeded are called,
+// in order, and the loop has a single backoff shared by all of them. The
+// Func, FuncWithAttempt and FuncCtx of the args are ignored.
+//
+// An attempt fails if any of the functions fail, with a *BatchError that
+// has the last error of each function. This is the error passed to
+// IsFatalError, NotifyFunc and the other callbacks, and is the LastError of
+// the error returned if the loop gives up.
+//
+// If an attempt times out due to the AttemptTimeout, the next attempt does
+// not start calling the functions until the previous attempt has finished.
+// If there are no functions, an error satisfying errors.IsNotValid is
+// returned.
+func CallAll(args CallArgs, funcs ...func() error) error {
+	if len(funcs) == 0 {
+		return errors.NotValidf("empty funcs")
+	}
+	var mu sync.Mutex
+	errs := make([]error, len(funcs))
+	done := make([]bool, len(funcs))
+	args.Func = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		failed := false
+		for i, f := range funcs {
+			if done[i] {
+				continue
+			}
+			errs[i] = f()
+			if errs[i] == nil {
+				done[i] = true
+			} else {
+				failed = true
+			}
+		}
+		if failed {
+			return &BatchError{Errors: copyErrors(errs)}
+		}
+		return nil
+	}
+	args.FuncWithAttempt = nil
+	args.FuncCtx = nil
+	return errors.Trace(Call(args))
+}
+
+// CallAny retries a set of functions until one of them succeeds, such as
+// when there are several mirrors that could be used. On each attempt the
+// functions are called in order, until one succeeds. The Func,
+// FuncWithAttempt and FuncCtx of the args are ignored.
+//
+// An attempt fails if every function fails, with a *BatchError that has
+// the error from each function. As with CallAll, this is the error passed
+// to the callbacks, and is the LastError of the error returned if the loop
+// gives up. If there are no functions, an error satisfying errors.IsNotValid
+// is returned, as none of them can succeed.
+func CallAny(args CallArgs, funcs ...func() error) error {
+	if len(funcs) == 0 {
+		return errors.NotValidf("empty funcs")
+	}
+	args.Func = func() error {
+		errs := make([]error, len(funcs))
+		for i, f := range funcs {
+			if errs[i] = f(); errs[i] == nil {
+				return nil
+			}
+		}
+		return &BatchError{Errors: errs}
+	}
+	args.FuncWithAttempt = nil
+	args.FuncCtx = nil
+	return errors.Trace(Call(args))
+}
+
+// CallAnyConcurrently behaves like CallAny, except that on each attempt all
+// the functions are called at the same time, each in its own goroutine. The
+// attempt succeeds as soon as any of the functions succeeds, without
+// waiting for the others, which are left to finish in the background. If
+// they all fail, the attempt fails once the last of them has returned.
+func CallAnyConcurrently(args CallArgs, funcs ...func() error) error {
+	if len(funcs) == 0 {
+		return errors.NotValidf("empty funcs")
+	}
+	type result struct {
+		index int
+		err   error
+	}
+	args.Func = func() error {
+		// The channel is buffered so the goroutines that are still running
+		// when the attempt succeeds can exit.
+		results := make(chan result, len(funcs))
+		for i, f := range funcs {
+			go func(i int, f func() error) {
+				results <- result{i, f()}
+			}(i, f)
+		}
+		errs := make([]error, len(funcs))
+		for range funcs {
+			r := <-results
+			if r.err == nil {
+				return nil
+			}
+			errs[r.index] = r.err
+		}
+		return &BatchError{Errors: errs}
+	}
+	args.FuncWithAttempt = nil
+	args.FuncCtx = nil
+	return errors.Trace(Call(args))
+}
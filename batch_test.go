@@ -0,0 +1,197 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type batchSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&batchSuite{})
+
+// failingFunc returns a function that fails until it has been called the
+// given number of times, recording each call in calls.
+func failingFunc(failures int, calls *int) func() error {
+	return func() error {
+		*calls++
+		if *calls <= failures {
+			return errors.Errorf("failure %d", *calls)
+		}
+		return nil
+	}
+}
+
+func (*batchSuite) TestAllSucceed(c *gc.C) {
+	clock := &mockClock{}
+	var calls [3]int
+	err := retry.CallAll(retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+	},
+		failingFunc(0, &calls[0]),
+		failingFunc(2, &calls[1]),
+		failingFunc(1, &calls[2]),
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	// Each function is only called until it succeeds.
+	c.Assert(calls, gc.Equals, [3]int{1, 3, 2})
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
+
+func (*batchSuite) TestAttemptsExceeded(c *gc.C) {
+	var calls [3]int
+	err := retry.CallAll(retry.CallArgs{
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	},
+		failingFunc(0, &calls[0]),
+		failingFunc(5, &calls[1]),
+		failingFunc(5, &calls[2]),
+	)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: 2 of 3 funcs failed: func 1: failure 3; func 2: failure 3`)
+	batch, ok := errors.Cause(err).(*retry.AttemptsExceeded).LastError.(*retry.BatchError)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(batch.Errors, gc.HasLen, 3)
+	c.Assert(batch.Errors[0], gc.IsNil)
+	c.Assert(batch.Errors[1], gc.ErrorMatches, "failure 3")
+	c.Assert(batch.Errors[2], gc.ErrorMatches, "failure 3")
+}
+
+func (*batchSuite) TestNotifyFunc(c *gc.C) {
+	var calls [2]int
+	var failed []int
+	err := retry.CallAll(retry.CallArgs{
+		NotifyFunc: func(err error, attempt int) {
+			batch := err.(*retry.BatchError)
+			count := 0
+			for _, err := range batch.Errors {
+				if err != nil {
+					count++
+				}
+			}
+			failed = append(failed, count)
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	},
+		failingFunc(1, &calls[0]),
+		failingFunc(2, &calls[1]),
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(failed, jc.DeepEquals, []int{2, 1})
+}
+
+func (*batchSuite) TestNoFuncs(c *gc.C) {
+	err := retry.CallAll(retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `empty funcs not valid`)
+}
+
+func (*batchSuite) TestCallAny(c *gc.C) {
+	clock := &mockClock{}
+	var calls [3]int
+	err := retry.CallAny(retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+	},
+		failingFunc(5, &calls[0]),
+		failingFunc(1, &calls[1]),
+		failingFunc(5, &calls[2]),
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	// The third function was only called on the first attempt, as the
+	// second succeeded on the second attempt.
+	c.Assert(calls, gc.Equals, [3]int{2, 2, 1})
+	c.Assert(clock.delays, gc.HasLen, 1)
+}
+
+func (*batchSuite) TestCallAnyAttemptsExceeded(c *gc.C) {
+	var calls [2]int
+	err := retry.CallAny(retry.CallArgs{
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	},
+		failingFunc(5, &calls[0]),
+		failingFunc(5, &calls[1]),
+	)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: 2 of 2 funcs failed: func 0: failure 2; func 1: failure 2`)
+	c.Assert(calls, gc.Equals, [2]int{2, 2})
+}
+
+func (*batchSuite) TestCallAnyConcurrently(c *gc.C) {
+	block := make(chan struct{})
+	defer close(block)
+	err := retry.CallAnyConcurrently(retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	},
+		func() error {
+			// This one doesn't return, but doesn't hold up the attempt.
+			<-block
+			return nil
+		},
+		func() error {
+			return nil
+		},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*batchSuite) TestCallAnyConcurrentlyAllFail(c *gc.C) {
+	err := retry.CallAnyConcurrently(retry.CallArgs{
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	},
+		func() error { return errors.New("foo") },
+		func() error { return errors.New("bar") },
+	)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: 2 of 2 funcs failed: func 0: foo; func 1: bar`)
+}
+
+func (*batchSuite) TestCallAnyNoFuncs(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	}
+	err := retry.CallAny(args)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `empty funcs not valid`)
+	err = retry.CallAnyConcurrently(args)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `empty funcs not valid`)
+}
+
+func (*batchSuite) TestBatchErrorUnwrap(c *gc.C) {
+	first := errors.New("first")
+	second := errors.New("second")
+	err := &retry.BatchError{Errors: []error{first, nil, second}}
+	// Only the functions that failed have errors to unwrap.
+	c.Assert(err.Unwrap(), jc.DeepEquals, []error{first, second})
+	c.Assert(stderrors.Is(err, second), jc.IsTrue)
+}
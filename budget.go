@@ -0,0 +1,85 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Budget limits the rate of retries across any number of Call invocations
+// that share it. It is a token bucket: each retry takes a token, and tokens
+// are replenished at a fixed rate up to a maximum burst. The first attempt of
+// a Call never takes a token. A Budget is safe for concurrent use.
+type Budget struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	tokens  float64
+	started bool
+	last    time.Time
+}
+
+// NewBudget returns a Budget that allows `ratePerSec` retries per second on
+// average, with up to `burst` retries at once.
+func NewBudget(ratePerSec float64, burst int) *Budget {
+	return &Budget{
+		rate:   ratePerSec,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// take takes a token from the budget if one is available. The time is
+// passed in so that the budget is replenished according to the Clock of the
+// Call.
+func (b *Budget) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started && now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	if !b.started || now.After(b.last) {
+		b.started = true
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// BudgetExhausted is the error that is returned when a retry is not made
+// because the Budget has no retries left. The last error returned from the
+// function being retried is available as the LastError attribute, every
+// error returned, in attempt order, is available as the Errors attribute, and
+// the total time spent retrying is available as the Elapsed attribute.
+type BudgetExhausted struct {
+	LastError error
+	Errors    []error
+	Elapsed   time.Duration
+}
+
+// Error provides the implementation for the error interface method.
+func (e *BudgetExhausted) Error() string {
+	return fmt.Sprintf("retry budget exhausted: %s", e.LastError)
+}
+
+// Unwrap returns the LastError.
+func (e *BudgetExhausted) Unwrap() error {
+	return e.LastError
+}
+
+// IsBudgetExhausted returns true if the error is a BudgetExhausted error.
+func IsBudgetExhausted(err error) bool {
+	_, ok := errors.Cause(err).(*BudgetExhausted)
+	return ok
+}
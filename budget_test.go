@@ -0,0 +1,131 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	stderrors "errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type budgetSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&budgetSuite{})
+
+func (*budgetSuite) TestBudgetExhausted(c *gc.C) {
+	clock := &mockClock{}
+	budget := retry.NewBudget(0, 3)
+	funcErr := errors.New("bah")
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return funcErr },
+		Attempts: 10,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Budget:   budget,
+	})
+	c.Assert(err, gc.ErrorMatches, `retry budget exhausted: bah`)
+	cause := errors.Cause(err)
+	c.Assert(cause, jc.Satisfies, retry.IsBudgetExhausted)
+	c.Assert(cause.(*retry.BudgetExhausted).LastError, gc.Equals, funcErr)
+	c.Assert(cause.(*retry.BudgetExhausted).Errors, gc.HasLen, 4)
+	c.Assert(clock.delays, gc.HasLen, 3)
+
+	// The budget is shared, so another call gets no retries.
+	count := 0
+	err = retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return funcErr
+		},
+		Attempts: 10,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Budget:   budget,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsBudgetExhausted)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (*budgetSuite) TestBudgetReplenished(c *gc.C) {
+	clock := &mockClock{}
+	// One retry a minute, with no burst beyond one.
+	budget := retry.NewBudget(1.0/60, 1)
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.New("bah")
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Budget:   budget,
+	})
+	// Each delay of a minute replenishes the single token.
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 5)
+
+	err = retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 5,
+		Delay:    time.Second,
+		Clock:    clock,
+		Budget:   budget,
+	})
+	// The token was used by the final retry above, and a second isn't
+	// long enough to replenish it after the first retry here.
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsBudgetExhausted)
+}
+
+func (*budgetSuite) TestBudgetConcurrent(c *gc.C) {
+	budget := retry.NewBudget(0, 50)
+	var (
+		mu    sync.Mutex
+		count int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retry.Call(retry.CallArgs{
+				Func: func() error {
+					mu.Lock()
+					count++
+					mu.Unlock()
+					return errors.New("bah")
+				},
+				Attempts: 20,
+				Delay:    time.Microsecond,
+				Budget:   budget,
+			})
+		}()
+	}
+	wg.Wait()
+	// Ten first attempts, and fifty retries between them.
+	c.Assert(count, gc.Equals, 60)
+}
+
+func (*budgetSuite) TestErrorsIs(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return io.EOF },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+		Budget:   retry.NewBudget(0, 0),
+	})
+	c.Assert(err, jc.Satisfies, retry.IsBudgetExhausted)
+	c.Assert(stderrors.Is(err, io.EOF), jc.IsTrue)
+	c.Assert(stderrors.Is(errors.Cause(err), io.EOF), jc.IsTrue)
+}
@@ -0,0 +1,393 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils/clock"
+)
+
+// Builder provides a fluent way to construct CallArgs. Each setter sets the
+// CallArgs field of the same name and returns the Builder so the calls can
+// be chained, for example:
+//
+//	args, err := retry.New().Func(f).Attempts(5).Delay(time.Minute).Build()
+type Builder struct {
+	args CallArgs
+}
+
+// New returns a Builder for CallArgs with no fields set.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Constant returns CallArgs for retrying with the same delay between every
+// attempt. The BackoffFactor is explicitly set to one to make the intent
+// clear. The Func still needs to be set, which can be done with WithFunc:
+//
+//	err := retry.Call(retry.Constant(5, time.Second).WithFunc(f))
+func Constant(attempts int, delay time.Duration) CallArgs {
+	return CallArgs{
+		Attempts:      attempts,
+		Delay:         delay,
+		BackoffFactor: 1,
+	}
+}
+
+// WithFunc returns a copy of the CallArgs with the Func set.
+func (args CallArgs) WithFunc(f func() error) CallArgs {
+	args.Func = f
+	return args
+}
+
+// Build validates the CallArgs that have been built up, as Call would with
+// any defaults from SetDefaults, and returns them. The CallArgs returned
+// are as they were built, without the defaults, so that Call applies the
+// defaults in effect when it is called.
+func (b *Builder) Build() (CallArgs, error) {
+	if _, err := b.args.validated(); err != nil {
+		return CallArgs{}, errors.Trace(err)
+	}
+	return b.args, nil
+}
+
+// Func sets the Func of the CallArgs.
+func (b *Builder) Func(f func() error) *Builder {
+	b.args.Func = f
+	return b
+}
+
+// FuncWithAttempt sets the FuncWithAttempt of the CallArgs.
+func (b *Builder) FuncWithAttempt(funcWithAttempt func(attempt int) error) *Builder {
+	b.args.FuncWithAttempt = funcWithAttempt
+	return b
+}
+
+// FuncCtx sets the FuncCtx of the CallArgs.
+func (b *Builder) FuncCtx(funcCtx func(ctx context.Context) error) *Builder {
+	b.args.FuncCtx = funcCtx
+	return b
+}
+
+// IsFatalError sets the IsFatalError of the CallArgs.
+func (b *Builder) IsFatalError(isFatalError func(error) bool) *Builder {
+	b.args.IsFatalError = isFatalError
+	return b
+}
+
+// IsRetryableError sets the IsRetryableError of the CallArgs.
+func (b *Builder) IsRetryableError(isRetryableError func(error) bool) *Builder {
+	b.args.IsRetryableError = isRetryableError
+	return b
+}
+
+// StartAttempt sets the StartAttempt of the CallArgs.
+func (b *Builder) StartAttempt(startAttempt func(attempt int) (end func(err error))) *Builder {
+	b.args.StartAttempt = startAttempt
+	return b
+}
+
+// NotifyFunc sets the NotifyFunc of the CallArgs.
+func (b *Builder) NotifyFunc(notifyFunc func(lastError error, attempt int)) *Builder {
+	b.args.NotifyFunc = notifyFunc
+	return b
+}
+
+// NotifyFuncV2 sets the NotifyFuncV2 of the CallArgs.
+func (b *Builder) NotifyFuncV2(notifyFunc func(err error, attempt int, willRetry, sameAsPrevious bool)) *Builder {
+	b.args.NotifyFuncV2 = notifyFunc
+	return b
+}
+
+// NotifyFuncWithState sets the NotifyFuncWithState of the CallArgs.
+func (b *Builder) NotifyFuncWithState(notifyFunc func(state State)) *Builder {
+	b.args.NotifyFuncWithState = notifyFunc
+	return b
+}
+
+// FatalFunc sets the FatalFunc of the CallArgs.
+func (b *Builder) FatalFunc(fatalFunc func(err error, attempt int)) *Builder {
+	b.args.FatalFunc = fatalFunc
+	return b
+}
+
+// ShouldRetry sets the ShouldRetry of the CallArgs.
+func (b *Builder) ShouldRetry(shouldRetry func(err error, attempt int) bool) *Builder {
+	b.args.ShouldRetry = shouldRetry
+	return b
+}
+
+// MaxConsecutiveSameError sets the MaxConsecutiveSameError of the CallArgs.
+func (b *Builder) MaxConsecutiveSameError(count int) *Builder {
+	b.args.MaxConsecutiveSameError = count
+	return b
+}
+
+// SameError sets the SameError of the CallArgs.
+func (b *Builder) SameError(sameError func(err, previous error) bool) *Builder {
+	b.args.SameError = sameError
+	return b
+}
+
+// IncludeFinalDelay sets the IncludeFinalDelay of the CallArgs.
+func (b *Builder) IncludeFinalDelay(includeFinalDelay bool) *Builder {
+	b.args.IncludeFinalDelay = includeFinalDelay
+	return b
+}
+
+// Attempts sets the Attempts of the CallArgs.
+func (b *Builder) Attempts(attempts int) *Builder {
+	b.args.Attempts = attempts
+	return b
+}
+
+// Delay sets the Delay of the CallArgs.
+func (b *Builder) Delay(delay time.Duration) *Builder {
+	b.args.Delay = delay
+	return b
+}
+
+// SpreadFirstAttempt sets the SpreadFirstAttempt of the CallArgs.
+func (b *Builder) SpreadFirstAttempt(spread time.Duration) *Builder {
+	b.args.SpreadFirstAttempt = spread
+	return b
+}
+
+// MaxDelay sets the MaxDelay of the CallArgs.
+func (b *Builder) MaxDelay(maxDelay time.Duration) *Builder {
+	b.args.MaxDelay = maxDelay
+	return b
+}
+
+// MaxDelayedAttempts sets the MaxDelayedAttempts of the CallArgs.
+func (b *Builder) MaxDelayedAttempts(maxDelayedAttempts int) *Builder {
+	b.args.MaxDelayedAttempts = maxDelayedAttempts
+	return b
+}
+
+// MinInterval sets the MinInterval of the CallArgs.
+func (b *Builder) MinInterval(minInterval time.Duration) *Builder {
+	b.args.MinInterval = minInterval
+	return b
+}
+
+// MinDelay sets the MinDelay of the CallArgs.
+func (b *Builder) MinDelay(minDelay time.Duration) *Builder {
+	b.args.MinDelay = minDelay
+	return b
+}
+
+// ErrorFormatter sets the ErrorFormatter of the CallArgs.
+func (b *Builder) ErrorFormatter(format func(lastError error, attempts int) string) *Builder {
+	b.args.ErrorFormatter = format
+	return b
+}
+
+// JoinErrors sets the JoinErrors of the CallArgs.
+func (b *Builder) JoinErrors(joinErrors bool) *Builder {
+	b.args.JoinErrors = joinErrors
+	return b
+}
+
+// MaxDuration sets the MaxDuration of the CallArgs.
+func (b *Builder) MaxDuration(maxDuration time.Duration) *Builder {
+	b.args.MaxDuration = maxDuration
+	return b
+}
+
+// Deadline sets the Deadline of the CallArgs.
+func (b *Builder) Deadline(deadline time.Time) *Builder {
+	b.args.Deadline = deadline
+	return b
+}
+
+// MaxDelayFraction sets the MaxDelayFraction of the CallArgs.
+func (b *Builder) MaxDelayFraction(fraction float64) *Builder {
+	b.args.MaxDelayFraction = fraction
+	return b
+}
+
+// BackoffFactor sets the BackoffFactor of the CallArgs.
+func (b *Builder) BackoffFactor(backoffFactor float64) *Builder {
+	b.args.BackoffFactor = backoffFactor
+	return b
+}
+
+// BackoffFactorJitter sets the BackoffFactorJitter of the CallArgs.
+func (b *Builder) BackoffFactorJitter(jitter float64) *Builder {
+	b.args.BackoffFactorJitter = jitter
+	return b
+}
+
+// AllowDecay sets the AllowDecay of the CallArgs.
+func (b *Builder) AllowDecay(allowDecay bool) *Builder {
+	b.args.AllowDecay = allowDecay
+	return b
+}
+
+// Clock sets the Clock of the CallArgs.
+func (b *Builder) Clock(c clock.Clock) *Builder {
+	b.args.Clock = c
+	return b
+}
+
+// Stop sets the Stop of the CallArgs.
+func (b *Builder) Stop(stop <-chan struct{}) *Builder {
+	b.args.Stop = stop
+	return b
+}
+
+// Canceller sets the Canceller of the CallArgs.
+func (b *Builder) Canceller(canceller Canceller) *Builder {
+	b.args.Canceller = canceller
+	return b
+}
+
+// Context sets the Context of the CallArgs.
+func (b *Builder) Context(ctx context.Context) *Builder {
+	b.args.Context = ctx
+	return b
+}
+
+// Jitter sets the Jitter of the CallArgs.
+func (b *Builder) Jitter(jitter bool) *Builder {
+	b.args.Jitter = jitter
+	return b
+}
+
+// BackoffFunc sets the BackoffFunc of the CallArgs.
+func (b *Builder) BackoffFunc(backoffFunc BackoffFunc) *Builder {
+	b.args.BackoffFunc = backoffFunc
+	return b
+}
+
+// BackoffForError sets the BackoffForError of the CallArgs.
+func (b *Builder) BackoffForError(backoffForError func(err error) float64) *Builder {
+	b.args.BackoffForError = backoffForError
+	return b
+}
+
+// DelayFunc sets the DelayFunc of the CallArgs.
+func (b *Builder) DelayFunc(delayFunc func(err error, attempt int, defaultDelay time.Duration) time.Duration) *Builder {
+	b.args.DelayFunc = delayFunc
+	return b
+}
+
+// ResetAfter sets the ResetAfter of the CallArgs.
+func (b *Builder) ResetAfter(resetAfter time.Duration) *Builder {
+	b.args.ResetAfter = resetAfter
+	return b
+}
+
+// AttemptTimeout sets the AttemptTimeout of the CallArgs.
+func (b *Builder) AttemptTimeout(attemptTimeout time.Duration) *Builder {
+	b.args.AttemptTimeout = attemptTimeout
+	return b
+}
+
+// RecoverPanics sets the RecoverPanics of the CallArgs.
+func (b *Builder) RecoverPanics(recoverPanics bool) *Builder {
+	b.args.RecoverPanics = recoverPanics
+	return b
+}
+
+// HedgeAfter sets the HedgeAfter of the CallArgs.
+func (b *Builder) HedgeAfter(hedgeAfter time.Duration) *Builder {
+	b.args.HedgeAfter = hedgeAfter
+	return b
+}
+
+// MaxHedges sets the MaxHedges of the CallArgs.
+func (b *Builder) MaxHedges(maxHedges int) *Builder {
+	b.args.MaxHedges = maxHedges
+	return b
+}
+
+// WaitFunc sets the WaitFunc of the CallArgs.
+func (b *Builder) WaitFunc(waitFunc func(ctx context.Context) error) *Builder {
+	b.args.WaitFunc = waitFunc
+	return b
+}
+
+// Executor sets the Executor of the CallArgs.
+func (b *Builder) Executor(executor Executor) *Builder {
+	b.args.Executor = executor
+	return b
+}
+
+// SuccessFunc sets the SuccessFunc of the CallArgs.
+func (b *Builder) SuccessFunc(successFunc func(attempt int, total time.Duration)) *Builder {
+	b.args.SuccessFunc = successFunc
+	return b
+}
+
+// Schedule sets the Schedule of the CallArgs.
+func (b *Builder) Schedule(schedule ...time.Duration) *Builder {
+	b.args.Schedule = schedule
+	return b
+}
+
+// InitialDelay sets the InitialDelay of the CallArgs.
+func (b *Builder) InitialDelay(initialDelay time.Duration) *Builder {
+	b.args.InitialDelay = initialDelay
+	return b
+}
+
+// IsFatalErrorWithAttempt sets the IsFatalErrorWithAttempt of the CallArgs.
+func (b *Builder) IsFatalErrorWithAttempt(isFatalErrorWithAttempt func(err error, attempt int) bool) *Builder {
+	b.args.IsFatalErrorWithAttempt = isFatalErrorWithAttempt
+	return b
+}
+
+// JitterFactor sets the JitterFactor of the CallArgs.
+func (b *Builder) JitterFactor(jitterFactor float64) *Builder {
+	b.args.JitterFactor = jitterFactor
+	return b
+}
+
+// Rand sets the Rand of the CallArgs.
+func (b *Builder) Rand(source *rand.Rand) *Builder {
+	b.args.Rand = source
+	return b
+}
+
+// Pauser sets the Pauser of the CallArgs.
+func (b *Builder) Pauser(pauser *Pauser) *Builder {
+	b.args.Pauser = pauser
+	return b
+}
+
+// DeadlineMargin sets the DeadlineMargin of the CallArgs.
+func (b *Builder) DeadlineMargin(margin time.Duration) *Builder {
+	b.args.DeadlineMargin = margin
+	return b
+}
+
+// FinalAttemptOnStop sets the FinalAttemptOnStop of the CallArgs.
+func (b *Builder) FinalAttemptOnStop(finalAttemptOnStop bool) *Builder {
+	b.args.FinalAttemptOnStop = finalAttemptOnStop
+	return b
+}
+
+// NotifyFuncWithDelay sets the NotifyFuncWithDelay of the CallArgs.
+func (b *Builder) NotifyFuncWithDelay(notifyFunc func(lastError error, attempt int, nextDelay time.Duration)) *Builder {
+	b.args.NotifyFuncWithDelay = notifyFunc
+	return b
+}
+
+// Metrics sets the Metrics of the CallArgs.
+func (b *Builder) Metrics(metrics Metrics) *Builder {
+	b.args.Metrics = metrics
+	return b
+}
+
+// Budget sets the Budget of the CallArgs.
+func (b *Builder) Budget(budget *Budget) *Builder {
+	b.args.Budget = budget
+	return b
+}
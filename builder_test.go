@@ -0,0 +1,85 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type builderSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&builderSuite{})
+
+func (*builderSuite) TestBuild(c *gc.C) {
+	clock := &mockClock{}
+	args, err := retry.New().
+		Func(func() error { return errors.New("bah") }).
+		Attempts(3).
+		Delay(time.Minute).
+		MaxDelay(3 * time.Minute).
+		BackoffFactor(2).
+		Clock(clock).
+		Build()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(args.Attempts, gc.Equals, 3)
+	c.Assert(args.Delay, gc.Equals, time.Minute)
+	c.Assert(args.MaxDelay, gc.Equals, 3*time.Minute)
+	c.Assert(args.BackoffFactor, gc.Equals, float64(2))
+
+	err = retry.Call(args)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+	})
+}
+
+func (*builderSuite) TestBuildLeavesDefaults(c *gc.C) {
+	args, err := retry.New().
+		Func(func() error { return nil }).
+		Attempts(3).
+		Delay(time.Minute).
+		Build()
+	c.Assert(err, jc.ErrorIsNil)
+	// The defaults are left for Call to fill in.
+	c.Assert(args.BackoffFactor, gc.Equals, float64(0))
+	c.Assert(args.Clock, gc.IsNil)
+}
+
+func (*builderSuite) TestBuildNotValid(c *gc.C) {
+	_, err := retry.New().
+		Func(func() error { return nil }).
+		Delay(time.Minute).
+		Build()
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `missing Attempts not valid`)
+}
+
+func (*builderSuite) TestConstant(c *gc.C) {
+	args := retry.Constant(4, time.Minute)
+	c.Assert(args.BackoffFactor, gc.Equals, float64(1))
+
+	clock := &mockClock{}
+	args.Clock = clock
+	withFunc := args.WithFunc(func() error { return errors.New("bah") })
+	c.Assert(args.Func, gc.IsNil)
+	c.Assert(withFunc.Validate(), jc.ErrorIsNil)
+
+	err := retry.Call(withFunc)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		time.Minute,
+		time.Minute,
+	})
+}
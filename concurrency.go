@@ -0,0 +1,90 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"sync"
+)
+
+// limiter limits the number of calls that are retrying at once.
+type limiter struct {
+	mu       sync.Mutex
+	max      int
+	retrying int
+	// released is closed, and replaced, whenever a slot may have become
+	// free.
+	released chan struct{}
+}
+
+var concurrency = &limiter{
+	released: make(chan struct{}),
+}
+
+// SetMaxConcurrent limits the number of calls, across the whole process,
+// that can be retrying at once. A call only needs a slot once its first
+// attempt has failed, so the first attempt is never held up. Before it
+// first waits to retry, a call queues for a slot, and it holds the slot
+// until it returns. While it is queueing, the Stop, Canceller and Context
+// interrupt it in the same way as they do the wait, and the time spent
+// queueing counts towards the MaxDuration or Deadline. If n is zero or
+// less, there is no limit, which is the default.
+//
+// Since the limit is shared by every call, a Func that itself makes a call
+// that needs to retry can deadlock once all the slots are taken, unless the
+// inner call has a Stop, Canceller or Context to interrupt it.
+func SetMaxConcurrent(n int) {
+	concurrency.mu.Lock()
+	defer concurrency.mu.Unlock()
+	concurrency.max = n
+	concurrency.notify()
+}
+
+// Retrying returns the number of calls that are currently retrying, that
+// is, that have had an attempt fail and have not yet returned. Calls that
+// are queueing because of SetMaxConcurrent are not included.
+func Retrying() int {
+	concurrency.mu.Lock()
+	defer concurrency.mu.Unlock()
+	return concurrency.retrying
+}
+
+// acquireSlot waits until a call is allowed to retry, unless interrupted by
+// the Stop channel, Canceller or Context first.
+func (args *CallArgs) acquireSlot() sleepResult {
+	stop, cancelled, done := args.stopChannels()
+	for {
+		concurrency.mu.Lock()
+		if concurrency.max <= 0 || concurrency.retrying < concurrency.max {
+			concurrency.retrying++
+			concurrency.mu.Unlock()
+			return sleepCompleted
+		}
+		released := concurrency.released
+		concurrency.mu.Unlock()
+		select {
+		case <-released:
+		case <-stop:
+			return sleepStopped
+		case <-cancelled:
+			return sleepStopped
+		case <-done:
+			return sleepCancelled
+		}
+	}
+}
+
+// releaseSlot gives back the slot taken by acquireSlot.
+func releaseSlot() {
+	concurrency.mu.Lock()
+	defer concurrency.mu.Unlock()
+	concurrency.retrying--
+	concurrency.notify()
+}
+
+// notify wakes up any calls that are queueing for a slot. It is called
+// with the mutex held.
+func (l *limiter) notify() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
@@ -0,0 +1,183 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+	"github.com/juju/retry/retrytest"
+)
+
+type concurrencySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&concurrencySuite{})
+
+func (s *concurrencySuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.AddCleanup(func(*gc.C) { retry.SetMaxConcurrent(0) })
+}
+
+// waitForRetrying waits until the number of retrying calls is n.
+func waitForRetrying(c *gc.C, n int) {
+	timeout := time.After(testing.LongWait)
+	for retry.Retrying() != n {
+		select {
+		case <-timeout:
+			c.Fatalf("got %d calls retrying, wanted %d", retry.Retrying(), n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (*concurrencySuite) TestFirstAttemptNotLimited(c *gc.C) {
+	retry.SetMaxConcurrent(1)
+	clock := retrytest.NewClock(time.Now())
+	first := callInBackground(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	waitForRetrying(c, 1)
+
+	// Another call that succeeds straight away doesn't need a slot.
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return nil
+		},
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 1)
+
+	c.Assert(clock.WaitAdvance(time.Minute, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(errors.Cause(waitForResult(c, first)), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(retry.Retrying(), gc.Equals, 0)
+}
+
+func (*concurrencySuite) TestQueueForSlot(c *gc.C) {
+	retry.SetMaxConcurrent(1)
+	clock := retrytest.NewClock(time.Now())
+	first := callInBackground(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	waitForRetrying(c, 1)
+	second := callInBackground(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Second,
+		Clock:    clock,
+	})
+	// The second call can't start waiting until the first has finished.
+	c.Assert(clock.WaitAdvance(time.Minute, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(errors.Cause(waitForResult(c, first)), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.WaitAdvance(time.Second, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(errors.Cause(waitForResult(c, second)), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.Delays(), jc.DeepEquals, []time.Duration{time.Minute, time.Second})
+	c.Assert(retry.Retrying(), gc.Equals, 0)
+}
+
+func (*concurrencySuite) TestQueueCountsTowardsMaxDuration(c *gc.C) {
+	retry.SetMaxConcurrent(1)
+	clock := retrytest.NewClock(time.Now())
+	first := callInBackground(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	waitForRetrying(c, 1)
+	called := make(chan struct{})
+	second := callInBackground(retry.CallArgs{
+		Func: func() error {
+			close(called)
+			return errors.New("bah")
+		},
+		Attempts:    2,
+		Delay:       time.Minute,
+		MaxDuration: 90 * time.Second,
+		Clock:       clock,
+	})
+	// The MaxDuration is measured from before the first attempt.
+	<-called
+	c.Assert(clock.WaitAdvance(time.Minute, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(errors.Cause(waitForResult(c, first)), jc.Satisfies, retry.IsAttemptsExceeded)
+	// After a minute in the queue, there isn't time left for the second
+	// call to wait for its delay.
+	c.Assert(errors.Cause(waitForResult(c, second)), jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(clock.Delays(), jc.DeepEquals, []time.Duration{time.Minute})
+	c.Assert(retry.Retrying(), gc.Equals, 0)
+}
+
+func (*concurrencySuite) TestQueueStopped(c *gc.C) {
+	retry.SetMaxConcurrent(1)
+	clock := retrytest.NewClock(time.Now())
+	first := callInBackground(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	waitForRetrying(c, 1)
+	stop := make(chan struct{})
+	close(stop)
+	var willRetry []bool
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		NotifyFuncV2: func(_ error, _ int, retrying, _ bool) {
+			willRetry = append(willRetry, retrying)
+		},
+		Attempts: 2,
+		Delay:    time.Second,
+		Clock:    clock,
+		Stop:     stop,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(retry.Retrying(), gc.Equals, 1)
+	// The failure is still reported, although there is no retry.
+	c.Assert(willRetry, jc.DeepEquals, []bool{false})
+
+	c.Assert(clock.WaitAdvance(time.Minute, testing.LongWait, 1), jc.ErrorIsNil)
+	waitForResult(c, first)
+	c.Assert(retry.Retrying(), gc.Equals, 0)
+}
+
+func (*concurrencySuite) TestRaisingLimitReleasesQueue(c *gc.C) {
+	retry.SetMaxConcurrent(1)
+	clock := retrytest.NewClock(time.Now())
+	first := callInBackground(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	waitForRetrying(c, 1)
+	second := callInBackground(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	retry.SetMaxConcurrent(0)
+	waitForRetrying(c, 2)
+	c.Assert(clock.WaitAdvance(time.Minute, testing.LongWait, 2), jc.ErrorIsNil)
+	waitForResult(c, first)
+	waitForResult(c, second)
+	c.Assert(retry.Retrying(), gc.Equals, 0)
+}
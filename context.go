@@ -0,0 +1,65 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"context"
+)
+
+// attemptKey is the context key for the attempt number.
+type attemptKey struct{}
+
+// withAttempt returns a context that carries the attempt number.
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// AttemptFromContext returns the attempt number carried by the context
+// passed to FuncCtx, starting at 1, so that code called by the FuncCtx can
+// know the attempt without it being passed down. The second result is false
+// if the context did not come from Call.
+func AttemptFromContext(ctx context.Context) (int, bool) {
+	attempt, ok := ctx.Value(attemptKey{}).(int)
+	return attempt, ok
+}
+
+// withStop returns a context for a call to the FuncCtx that is cancelled
+// if the Stop channel is closed or the Canceller is done during the call,
+// so that the FuncCtx can give up rather than the loop waiting for it. If
+// either was already closed when the call started, it is ignored, so that
+// the first attempt still gets a chance to succeed, as it would for Func.
+// The cancel function must be called once the call is over.
+func (args *CallArgs) withStop(ctx context.Context) (context.Context, context.CancelFunc) {
+	stop, cancelled, _ := args.stopChannels()
+	if isClosed(stop) {
+		stop = nil
+	}
+	if isClosed(cancelled) {
+		cancelled = nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if stop == nil && cancelled == nil {
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-stop:
+		case <-cancelled:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// isClosed returns true if the channel is closed, and false if it is nil
+// or still open.
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+	"github.com/juju/retry/retrytest"
+)
+
+type contextSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&contextSuite{})
+
+func (*contextSuite) TestAttemptFromContext(c *gc.C) {
+	var attempts []int
+	err := retry.Call(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			attempt, ok := retry.AttemptFromContext(ctx)
+			c.Check(ok, jc.IsTrue)
+			attempts = append(attempts, attempt)
+			return errors.New("bah")
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(attempts, jc.DeepEquals, []int{1, 2, 3})
+}
+
+func (*contextSuite) TestAttemptFromContextWithTimeout(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			attempt, ok := retry.AttemptFromContext(ctx)
+			c.Check(ok, jc.IsTrue)
+			c.Check(attempt, gc.Equals, 1)
+			return nil
+		},
+		Attempts:       3,
+		Delay:          time.Minute,
+		AttemptTimeout: time.Hour,
+		Clock:          retrytest.NewClock(time.Now()),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*contextSuite) TestAttemptFromContextMissing(c *gc.C) {
+	attempt, ok := retry.AttemptFromContext(context.Background())
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(attempt, gc.Equals, 0)
+}
+
+func (*contextSuite) TestCancelledDuringFunc(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	var notified []bool
+	err := retry.Call(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			count++
+			cancel()
+			return fmt.Errorf("getting: %w", ctx.Err())
+		},
+		NotifyFuncV2: func(_ error, _ int, willRetry, _ bool) {
+			notified = append(notified, willRetry)
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Context:  ctx,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, gc.ErrorMatches, `getting: context canceled`)
+	c.Assert(stderrors.Is(err, context.Canceled), jc.IsTrue)
+	c.Assert(count, gc.Equals, 1)
+	c.Assert(notified, jc.DeepEquals, []bool{false})
+}
+
+func (*contextSuite) TestContextErrorRetriedWhileContextNotDone(c *gc.C) {
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		FuncCtx: func(context.Context) error {
+			count++
+			// For instance a timeout within the Func.
+			return fmt.Errorf("getting: %w", context.DeadlineExceeded)
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Context:  context.Background(),
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (*contextSuite) TestCancelledDuringFuncIsFatalErrorOverride(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	var notified []bool
+	err := retry.Call(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			count++
+			cancel()
+			return ctx.Err()
+		},
+		NotifyFuncV2: func(_ error, _ int, willRetry, _ bool) {
+			notified = append(notified, willRetry)
+		},
+		IsFatalError: func(error) bool { return false },
+		Attempts:     3,
+		Delay:        time.Minute,
+		Context:      ctx,
+		Clock:        &mockClock{},
+	})
+	// The error isn't fatal, so the loop only stops when the wait for the
+	// next attempt sees that the Context is done.
+	c.Assert(errors.Cause(err), gc.Equals, context.Canceled)
+	c.Assert(count, gc.Equals, 1)
+	c.Assert(notified, jc.DeepEquals, []bool{true})
+}
+
+func (*contextSuite) TestStopDuringFuncCtxCancelsContext(c *gc.C) {
+	stop := make(chan struct{})
+	started := make(chan struct{})
+	result := callInBackground(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			close(started)
+			return waitForDone(ctx)
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Stop:     stop,
+		Clock:    &mockClock{},
+	})
+	select {
+	case <-started:
+	case <-time.After(testing.LongWait):
+		c.Fatalf("FuncCtx not called")
+	}
+	close(stop)
+	err := waitForResult(c, result)
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(errors.Cause(err).(*retry.RetryStopped).LastError, gc.Equals, context.Canceled)
+}
+
+func (*contextSuite) TestCancellerDuringFuncCtxCancelsContext(c *gc.C) {
+	canceller, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := callInBackground(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			cancel()
+			return waitForDone(ctx)
+		},
+		Attempts:  3,
+		Delay:     time.Minute,
+		Canceller: canceller,
+		Clock:     &mockClock{},
+	})
+	err := waitForResult(c, result)
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+}
+
+func (*contextSuite) TestStopBeforeFuncCtxLeavesContext(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	// The first attempt is still made with a live context.
+	err := retry.Call(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			return ctx.Err()
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Stop:     stop,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
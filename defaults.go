@@ -0,0 +1,74 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+var (
+	defaultsMu sync.RWMutex
+	defaults   CallArgs
+)
+
+// SetDefaults sets the policy that Call uses for any of the Delay, Attempts,
+// BackoffFactor, MaxDelay and Clock that are not set in the CallArgs it is
+// given. The other fields of the defaults are ignored. A field set in the
+// CallArgs always wins over the default. As the defaults would otherwise
+// make the CallArgs not valid, the Delay, Attempts and BackoffFactor are not
+// defaulted if a Schedule is set, the Delay is not defaulted if a WaitFunc
+// is set, the BackoffFactor is not defaulted if a BackoffFunc or
+// BackoffForError is set, and the MaxDelay is not defaulted if it would be
+// less than the Delay, which it would then override. Calling SetDefaults
+// with an empty CallArgs removes the defaults. It is safe to call
+// SetDefaults while Call is being used in other goroutines.
+func SetDefaults(args CallArgs) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaults = CallArgs{
+		Delay:         args.Delay,
+		Attempts:      args.Attempts,
+		BackoffFactor: args.BackoffFactor,
+		MaxDelay:      args.MaxDelay,
+		Clock:         args.Clock,
+	}
+}
+
+// validated returns a copy of the CallArgs with the defaults applied and
+// validated, as they would be by Call, leaving the CallArgs themselves as
+// they were so that later defaults still apply to them.
+func (args CallArgs) validated() (CallArgs, error) {
+	args.applyDefaults()
+	if err := args.Validate(); err != nil {
+		return CallArgs{}, errors.Trace(err)
+	}
+	return args, nil
+}
+
+// applyDefaults fills in any unset fields from the defaults given to
+// SetDefaults.
+func (args *CallArgs) applyDefaults() {
+	defaultsMu.RLock()
+	d := defaults
+	defaultsMu.RUnlock()
+	if len(args.Schedule) == 0 {
+		if args.Delay == 0 && args.WaitFunc == nil {
+			args.Delay = d.Delay
+		}
+		if args.Attempts == 0 {
+			args.Attempts = d.Attempts
+		}
+		if args.BackoffFactor == 0 && args.BackoffFunc == nil && args.BackoffForError == nil {
+			args.BackoffFactor = d.BackoffFactor
+		}
+	}
+	if args.MaxDelay == 0 && d.MaxDelay >= args.Delay {
+		args.MaxDelay = d.MaxDelay
+	}
+	if args.Clock == nil {
+		args.Clock = d.Clock
+	}
+}
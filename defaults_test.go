@@ -0,0 +1,211 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type defaultsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&defaultsSuite{})
+
+func (s *defaultsSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.AddCleanup(func(*gc.C) { retry.SetDefaults(retry.CallArgs{}) })
+}
+
+func (*defaultsSuite) TestDefaultsUsed(c *gc.C) {
+	clock := &mockClock{}
+	retry.SetDefaults(retry.CallArgs{
+		Delay:         time.Second,
+		Attempts:      5,
+		BackoffFactor: 2,
+		MaxDelay:      5 * time.Second,
+		Clock:         clock,
+		// Other fields are ignored.
+		MaxDuration: time.Millisecond,
+	})
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.New("bah")
+		},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 5)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+	})
+}
+
+func (*defaultsSuite) TestExplicitFieldsWin(c *gc.C) {
+	retry.SetDefaults(retry.CallArgs{
+		Delay:         time.Second,
+		Attempts:      5,
+		BackoffFactor: 2,
+		MaxDelay:      5 * time.Second,
+		Clock:         &mockClock{},
+	})
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Delay:         time.Minute,
+		Attempts:      3,
+		BackoffFactor: 3,
+		MaxDelay:      time.Hour,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		3 * time.Minute,
+	})
+}
+
+func (*defaultsSuite) TestDefaultsNotConflicting(c *gc.C) {
+	retry.SetDefaults(retry.CallArgs{
+		Delay:         time.Second,
+		Attempts:      5,
+		BackoffFactor: 2,
+		MaxDelay:      5 * time.Second,
+	})
+	// The Schedule replaces the default Delay, Attempts and BackoffFactor.
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Schedule: []time.Duration{time.Second, 3 * time.Second},
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Second, 3 * time.Second})
+
+	// The default MaxDelay is not used when it is less than the Delay, and
+	// the BackoffFactor is not used with a BackoffFunc.
+	clock = &mockClock{}
+	err = retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		Delay:       time.Minute,
+		Attempts:    3,
+		BackoffFunc: func(delay time.Duration, _ int) time.Duration { return delay },
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute, time.Minute})
+}
+
+func (*defaultsSuite) TestSetDefaultsConcurrently(c *gc.C) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			retry.SetDefaults(retry.CallArgs{Attempts: 2, Delay: time.Second})
+		}()
+		go func() {
+			defer wg.Done()
+			err := retry.Call(retry.CallArgs{
+				Func:     func() error { return nil },
+				Attempts: 2,
+				Delay:    time.Second,
+				Clock:    &mockClock{},
+			})
+			c.Check(err, jc.ErrorIsNil)
+		}()
+	}
+	wg.Wait()
+}
+
+func (*defaultsSuite) TestDefaultsUsedByCallStats(c *gc.C) {
+	retry.SetDefaults(retry.CallArgs{
+		Delay:    time.Millisecond,
+		Attempts: 2,
+		Clock:    &mockClock{},
+	})
+	stats, err := retry.CallStats(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(stats.Attempts, gc.Equals, 2)
+	c.Assert(stats.Status, gc.Equals, retry.StatusAttemptsExceeded)
+}
+
+func (*defaultsSuite) TestDefaultsUsedByRetryer(c *gc.C) {
+	retry.SetDefaults(retry.CallArgs{
+		Delay:    time.Millisecond,
+		Attempts: 2,
+		Clock:    &mockClock{},
+	})
+	retryer, err := retry.NewRetryer(retry.CallArgs{})
+	c.Assert(err, jc.ErrorIsNil)
+	// A default set later is still picked up by Run.
+	clock := &mockClock{}
+	retry.SetDefaults(retry.CallArgs{
+		Delay:    time.Second,
+		Attempts: 3,
+		Clock:    clock,
+	})
+	count := 0
+	err = retryer.Run(func() error {
+		count++
+		return errors.New("bah")
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 3)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Second, time.Second})
+}
+
+func (*defaultsSuite) TestDefaultsUsedByBuild(c *gc.C) {
+	retry.SetDefaults(retry.CallArgs{
+		Delay:    time.Millisecond,
+		Attempts: 2,
+	})
+	args, err := retry.New().Func(func() error { return nil }).Build()
+	c.Assert(err, jc.ErrorIsNil)
+	// The built CallArgs are left for Call to apply the defaults to.
+	c.Assert(args.Clock, gc.IsNil)
+	c.Assert(args.BackoffFactor, gc.Equals, float64(0))
+	c.Assert(retry.Call(args), jc.ErrorIsNil)
+}
+
+func (*defaultsSuite) TestDefaultsUsedByPreview(c *gc.C) {
+	retry.SetDefaults(retry.CallArgs{
+		Delay:    time.Second,
+		Attempts: 3,
+	})
+	args := retry.CallArgs{}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview.Attempts, gc.Equals, 3)
+	c.Assert(preview.Delays, jc.DeepEquals, []time.Duration{time.Second, time.Second})
+	c.Assert(args.DelaySchedule(), jc.DeepEquals, []time.Duration{time.Second, time.Second})
+}
+
+func (*defaultsSuite) TestDefaultsUsedByCapToTotal(c *gc.C) {
+	retry.SetDefaults(retry.CallArgs{
+		Delay:         time.Second,
+		Attempts:      4,
+		BackoffFactor: 2,
+	})
+	capped, err := retry.CapToTotal(retry.CallArgs{}, 5*time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	// Only the MaxDelay is set, so the other defaults still apply.
+	c.Assert(capped.MaxDelay, gc.Equals, 2*time.Second)
+	c.Assert(capped.Delay, gc.Equals, time.Duration(0))
+	c.Assert(capped.DelaySchedule(), jc.DeepEquals, []time.Duration{time.Second, 2 * time.Second, 2 * time.Second})
+}
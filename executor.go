@@ -0,0 +1,58 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"context"
+)
+
+// Executor is the interface that an Executor in the CallArgs must
+// implement, such as a size-limited pool of worker goroutines shared by
+// many calls.
+//
+// Submit must call the function it is given exactly once, on any
+// goroutine, and may return before or after doing so. Call waits for the
+// function to have been called, so an Executor that has been shut down
+// must still call the function, for instance straight away on the
+// goroutine that called Submit. An Executor that drops the function would
+// leave Call waiting forever, or until the AttemptTimeout if there is one.
+type Executor interface {
+	Submit(f func())
+}
+
+// execution is the outcome of calling the func on the Executor.
+type execution struct {
+	err      error
+	panicked bool
+	value    interface{}
+}
+
+// execute calls the func for the attempt, on the Executor if there is one,
+// and waits for it to return. A panic on the Executor is recovered there,
+// so that the worker survives, and carries on from here, as if the func
+// had been called on this goroutine.
+func (args *CallArgs) execute(ctx context.Context, attempt int) error {
+	if args.Executor == nil {
+		return args.callFunc(ctx, attempt)
+	}
+	// The channel is buffered so that the Executor never blocks on a call
+	// that has been given up on because of the AttemptTimeout.
+	result := make(chan execution, 1)
+	args.Executor.Submit(func() {
+		returned := false
+		defer func() {
+			if !returned {
+				result <- execution{panicked: true, value: recover()}
+			}
+		}()
+		err := args.callFunc(ctx, attempt)
+		returned = true
+		result <- execution{err: err}
+	})
+	outcome := <-result
+	if outcome.panicked {
+		panic(outcome.value)
+	}
+	return outcome.err
+}
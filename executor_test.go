@@ -0,0 +1,162 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type executorSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&executorSuite{})
+
+// workerPool is an Executor with a fixed number of workers. Once it has
+// been shut down, functions are called on the goroutine that submits them.
+type workerPool struct {
+	funcs chan func()
+	wg    sync.WaitGroup
+
+	mu        sync.Mutex
+	shutdown  bool
+	submitted int
+}
+
+func newWorkerPool(workers int) *workerPool {
+	pool := &workerPool{funcs: make(chan func())}
+	pool.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer pool.wg.Done()
+			for f := range pool.funcs {
+				f()
+			}
+		}()
+	}
+	return pool
+}
+
+func (pool *workerPool) Submit(f func()) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.submitted++
+	if pool.shutdown {
+		f()
+		return
+	}
+	pool.funcs <- f
+}
+
+func (pool *workerPool) Shutdown() {
+	pool.mu.Lock()
+	pool.shutdown = true
+	close(pool.funcs)
+	pool.mu.Unlock()
+	pool.wg.Wait()
+}
+
+func (pool *workerPool) submitCount() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.submitted
+}
+
+func (*executorSuite) TestExecutor(c *gc.C) {
+	pool := newWorkerPool(1)
+	defer pool.Shutdown()
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count < 3 {
+				return errors.New("bah")
+			}
+			return nil
+		},
+		Executor: pool,
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 3)
+	c.Assert(pool.submitCount(), gc.Equals, 3)
+}
+
+func (*executorSuite) TestExecutorBoundsConcurrency(c *gc.C) {
+	pool := newWorkerPool(2)
+	defer pool.Shutdown()
+	var mu sync.Mutex
+	running, most := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := retry.Call(retry.CallArgs{
+				Func: func() error {
+					mu.Lock()
+					running++
+					if running > most {
+						most = running
+					}
+					mu.Unlock()
+					time.Sleep(time.Millisecond)
+					mu.Lock()
+					running--
+					mu.Unlock()
+					return nil
+				},
+				Executor: pool,
+				Attempts: 1,
+				Delay:    time.Minute,
+			})
+			c.Check(err, jc.ErrorIsNil)
+		}()
+	}
+	wg.Wait()
+	c.Assert(most <= 2, jc.IsTrue)
+	c.Assert(pool.submitCount(), gc.Equals, 10)
+}
+
+func (*executorSuite) TestExecutorShutdown(c *gc.C) {
+	pool := newWorkerPool(1)
+	pool.Shutdown()
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return nil },
+		Executor: pool,
+		Attempts: 1,
+		Delay:    time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pool.submitCount(), gc.Equals, 1)
+}
+
+func (*executorSuite) TestExecutorPanic(c *gc.C) {
+	pool := newWorkerPool(1)
+	defer pool.Shutdown()
+	args := retry.CallArgs{
+		Func:     func() error { panic("oops") },
+		Executor: pool,
+		Attempts: 1,
+		Delay:    time.Minute,
+	}
+	// The panic carries on from Call rather than killing the worker.
+	c.Assert(func() { retry.Call(args) }, gc.PanicMatches, `oops`)
+	args.RecoverPanics = true
+	err := retry.Call(args)
+	c.Assert(err, jc.Satisfies, retry.IsPanicError)
+	// The worker is still there to run the next call.
+	args.Func = func() error { return nil }
+	c.Assert(retry.Call(args), jc.ErrorIsNil)
+}
@@ -0,0 +1,11 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+var (
+	RandFloat64 = &randFloat64
+	Yield       = &yield
+	CallFunc    = (*CallArgs).callFunc
+	Aborted     = aborted
+)
@@ -0,0 +1,31 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"github.com/juju/errors"
+)
+
+// CallWithFallback runs the retry loop defined by the args, as Call does,
+// and if the loop gives up because the Attempts or MaxDuration have been
+// used up, calls the fallback once and returns its result instead.
+//
+// The fallback is not called in any other case:
+//   - if Func succeeds, nil is returned;
+//   - if the error is fatal, according to IsFatalError or
+//     IsRetryableError, that error is returned;
+//   - if the loop is stopped or cancelled, or ShouldRetry returns false, or
+//     the Budget is exhausted, the same error as Call returns is returned;
+//   - if the args are not valid, the validation error is returned.
+func CallWithFallback(args CallArgs, fallback func() error) error {
+	_, err := args.run()
+	if err == nil {
+		return nil
+	}
+	cause := errors.Cause(err)
+	if !IsAttemptsExceeded(cause) && !IsDurationExceeded(cause) {
+		return errors.Trace(args.single(err))
+	}
+	return errors.Trace(fallback())
+}
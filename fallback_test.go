@@ -0,0 +1,150 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type fallbackSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&fallbackSuite{})
+
+func (*fallbackSuite) TestSuccess(c *gc.C) {
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:     func() error { return nil },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	}, func() error {
+		c.Fatalf("fallback called")
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*fallbackSuite) TestAttemptsExceeded(c *gc.C) {
+	clock := &mockClock{}
+	called := 0
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    clock,
+	}, func() error {
+		called++
+		return errors.New("fallback failed")
+	})
+	c.Assert(err, gc.ErrorMatches, "fallback failed")
+	c.Assert(called, gc.Equals, 1)
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
+
+func (*fallbackSuite) TestSingleAttempt(c *gc.C) {
+	called := 0
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 1,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	}, func() error {
+		called++
+		return nil
+	})
+	// The attempts are used up, although the error from Func is bare.
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(called, gc.Equals, 1)
+}
+
+func (*fallbackSuite) TestSingleAttemptFatalError(c *gc.C) {
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:         func() error { return errors.New("fatal") },
+		IsFatalError: func(error) bool { return true },
+		Attempts:     1,
+		Delay:        time.Minute,
+		Clock:        &mockClock{},
+	}, func() error {
+		c.Fatalf("fallback called")
+		return nil
+	})
+	c.Assert(err, gc.ErrorMatches, "fatal")
+}
+
+func (*fallbackSuite) TestFallbackSucceeds(c *gc.C) {
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	}, func() error {
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*fallbackSuite) TestDurationExceeded(c *gc.C) {
+	called := 0
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		Attempts:    retry.UnlimitedAttempts,
+		Delay:       time.Minute,
+		MaxDuration: 90 * time.Second,
+		Clock:       &mockClock{},
+	}, func() error {
+		called++
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(called, gc.Equals, 1)
+}
+
+func (*fallbackSuite) TestFatalError(c *gc.C) {
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:         func() error { return errors.New("fatal") },
+		IsFatalError: func(error) bool { return true },
+		Attempts:     3,
+		Delay:        time.Minute,
+		Clock:        &mockClock{},
+	}, func() error {
+		c.Fatalf("fallback called")
+		return nil
+	})
+	c.Assert(err, gc.ErrorMatches, "fatal")
+}
+
+func (*fallbackSuite) TestStopped(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+		Stop:     stop,
+	}, func() error {
+		c.Fatalf("fallback called")
+		return nil
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+}
+
+func (*fallbackSuite) TestNotValid(c *gc.C) {
+	err := retry.CallWithFallback(retry.CallArgs{
+		Func:  func() error { return nil },
+		Delay: time.Minute,
+	}, func() error {
+		c.Fatalf("fallback called")
+		return nil
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
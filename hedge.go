@@ -0,0 +1,106 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+)
+
+// validateHedge checks that the HedgeAfter and MaxHedges make sense.
+func (args *CallArgs) validateHedge() error {
+	if args.HedgeAfter < 0 {
+		return errors.NotValidf("HedgeAfter of %v", args.HedgeAfter)
+	}
+	if args.MaxHedges < 0 {
+		return errors.NotValidf("MaxHedges of %d", args.MaxHedges)
+	}
+	if args.HedgeAfter == 0 {
+		if args.MaxHedges > 0 {
+			return errors.NotValidf("MaxHedges without HedgeAfter")
+		}
+		return nil
+	}
+	if args.FuncCtx == nil {
+		return errors.NotValidf("HedgeAfter without FuncCtx")
+	}
+	return nil
+}
+
+// maxHedges returns the number of hedged calls that may be made for each
+// attempt, in addition to the first call.
+func (args *CallArgs) maxHedges() int {
+	if args.MaxHedges == 0 {
+		return 1
+	}
+	return args.MaxHedges
+}
+
+// hedge calls the FuncCtx for the attempt, and each time the HedgeAfter
+// passes without any call having succeeded, starts another call alongside
+// the ones in flight, up to the maxHedges. The first nil error is returned
+// straight away, and the context of the other calls is cancelled. If every
+// call fails, the error from the last one to return is returned. A panic in
+// any of the calls carries on from the goroutine that called hedge.
+func (args *CallArgs) hedge(ctx context.Context, attempt int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	// Cancelling the context tells the calls that lost to give up.
+	defer cancel()
+	hedges := args.maxHedges()
+	results := make(chan execution)
+	// finished is closed once hedge returns, so that the calls that lost
+	// can exit.
+	finished := make(chan struct{})
+	defer close(finished)
+	start := func() {
+		go func() {
+			returned := false
+			defer func() {
+				if returned {
+					return
+				}
+				r := recover()
+				select {
+				case results <- execution{panicked: true, value: r}:
+				case <-finished:
+					// No one is waiting for the call any more, so the
+					// panic carries on here.
+					panic(r)
+				}
+			}()
+			err := args.execute(ctx, attempt)
+			returned = true
+			select {
+			case results <- execution{err: err}:
+			case <-finished:
+			}
+		}()
+	}
+	start()
+	inFlight, started := 1, 0
+	after := args.Clock.After(args.HedgeAfter)
+	var err error
+	for inFlight > 0 {
+		select {
+		case outcome := <-results:
+			inFlight--
+			if outcome.panicked {
+				panic(outcome.value)
+			}
+			if err = outcome.err; err == nil {
+				return nil
+			}
+		case <-after:
+			start()
+			inFlight++
+			started++
+			after = nil
+			if started < hedges {
+				after = args.Clock.After(args.HedgeAfter)
+			}
+		}
+	}
+	return err
+}
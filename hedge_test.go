@@ -0,0 +1,241 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+	"github.com/juju/retry/retrytest"
+)
+
+type hedgeSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&hedgeSuite{})
+
+// hedgedFunc is used as a FuncCtx. It runs the nth call with the nth
+// function, counting from zero.
+type hedgedFunc struct {
+	mu    sync.Mutex
+	funcs []func(ctx context.Context) error
+	calls int
+}
+
+func (f *hedgedFunc) call(ctx context.Context) error {
+	f.mu.Lock()
+	call := f.funcs[f.calls]
+	f.calls++
+	f.mu.Unlock()
+	return call(ctx)
+}
+
+func (f *hedgedFunc) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func waitForDone(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func callInBackground(args retry.CallArgs) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- retry.Call(args)
+	}()
+	return result
+}
+
+func waitForResult(c *gc.C, result <-chan error) error {
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(testing.LongWait):
+		c.Fatalf("Call did not return")
+	}
+	panic("unreachable")
+}
+
+func (*hedgeSuite) TestHedgeSucceeds(c *gc.C) {
+	clock := retrytest.NewClock(time.Now())
+	lost := make(chan error, 1)
+	f := &hedgedFunc{funcs: []func(context.Context) error{
+		func(ctx context.Context) error {
+			err := waitForDone(ctx)
+			lost <- err
+			return err
+		},
+		func(context.Context) error { return nil },
+	}}
+	result := callInBackground(retry.CallArgs{
+		FuncCtx:    f.call,
+		Attempts:   3,
+		Delay:      time.Minute,
+		HedgeAfter: time.Second,
+		Clock:      clock,
+	})
+	c.Assert(clock.WaitAdvance(time.Second, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(waitForResult(c, result), jc.ErrorIsNil)
+	// The call that lost has its context cancelled.
+	select {
+	case err := <-lost:
+		c.Assert(err, gc.Equals, context.Canceled)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("the first call was not cancelled")
+	}
+	c.Assert(f.callCount(), gc.Equals, 2)
+}
+
+func (*hedgeSuite) TestNoHedgeWhenFast(c *gc.C) {
+	clock := retrytest.NewClock(time.Now())
+	f := &hedgedFunc{funcs: []func(context.Context) error{
+		func(context.Context) error { return nil },
+	}}
+	err := retry.Call(retry.CallArgs{
+		FuncCtx:    f.call,
+		Attempts:   3,
+		Delay:      time.Minute,
+		HedgeAfter: time.Second,
+		Clock:      clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(f.callCount(), gc.Equals, 1)
+	c.Assert(clock.Delays(), jc.DeepEquals, []time.Duration{time.Second})
+}
+
+func (*hedgeSuite) TestHedgePanic(c *gc.C) {
+	call := func() {
+		retry.Call(retry.CallArgs{
+			FuncCtx:    func(context.Context) error { panic("bah") },
+			Attempts:   3,
+			Delay:      time.Minute,
+			HedgeAfter: time.Second,
+			Clock:      retrytest.NewClock(time.Now()),
+		})
+	}
+	// The panic reaches the caller rather than crashing the goroutine
+	// that made the call.
+	c.Assert(call, gc.PanicMatches, `bah`)
+}
+
+func (*hedgeSuite) TestAllHedgesFail(c *gc.C) {
+	clock := retrytest.NewClock(time.Now())
+	release := make(chan struct{})
+	first := errors.New("first")
+	f := &hedgedFunc{funcs: []func(context.Context) error{
+		func(context.Context) error {
+			<-release
+			return first
+		},
+		func(context.Context) error {
+			defer close(release)
+			return errors.New("second")
+		},
+	}}
+	result := callInBackground(retry.CallArgs{
+		FuncCtx:    f.call,
+		Attempts:   1,
+		Delay:      time.Minute,
+		HedgeAfter: time.Second,
+		Clock:      clock,
+	})
+	c.Assert(clock.WaitAdvance(time.Second, testing.LongWait, 1), jc.ErrorIsNil)
+	// The error from the last call to return is used for the attempt.
+	err := waitForResult(c, result)
+	c.Assert(errors.Cause(err), gc.Equals, first)
+	c.Assert(f.callCount(), gc.Equals, 2)
+}
+
+func (*hedgeSuite) TestHedgeFailureIsRetried(c *gc.C) {
+	clock := retrytest.NewClock(time.Now())
+	f := &hedgedFunc{funcs: []func(context.Context) error{
+		func(context.Context) error { return errors.New("bah") },
+		func(context.Context) error { return nil },
+	}}
+	result := callInBackground(retry.CallArgs{
+		FuncCtx:    f.call,
+		Attempts:   3,
+		Delay:      time.Minute,
+		HedgeAfter: time.Second,
+		Clock:      clock,
+	})
+	// The first attempt fails before the HedgeAfter, leaving its hedge
+	// wait behind, so the retry delay is the second wait.
+	c.Assert(clock.WaitAdvance(time.Minute, testing.LongWait, 2), jc.ErrorIsNil)
+	c.Assert(waitForResult(c, result), jc.ErrorIsNil)
+	c.Assert(f.callCount(), gc.Equals, 2)
+}
+
+func (*hedgeSuite) TestMaxHedges(c *gc.C) {
+	clock := retrytest.NewClock(time.Now())
+	f := &hedgedFunc{funcs: []func(context.Context) error{
+		waitForDone,
+		waitForDone,
+		func(context.Context) error { return nil },
+	}}
+	result := callInBackground(retry.CallArgs{
+		FuncCtx:    f.call,
+		Attempts:   3,
+		Delay:      time.Minute,
+		HedgeAfter: time.Second,
+		MaxHedges:  2,
+		Clock:      clock,
+	})
+	c.Assert(clock.WaitAdvance(time.Second, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(clock.WaitAdvance(time.Second, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(waitForResult(c, result), jc.ErrorIsNil)
+	c.Assert(f.callCount(), gc.Equals, 3)
+	c.Assert(clock.Delays(), jc.DeepEquals, []time.Duration{time.Second, time.Second})
+}
+
+func (*hedgeSuite) TestHedgeNotValid(c *gc.C) {
+	funcCtx := func(context.Context) error { return nil }
+	for i, test := range []struct {
+		args retry.CallArgs
+		err  string
+	}{{
+		args: retry.CallArgs{
+			Func:       func() error { return nil },
+			HedgeAfter: time.Second,
+		},
+		err: `HedgeAfter without FuncCtx not valid`,
+	}, {
+		args: retry.CallArgs{
+			FuncCtx:    funcCtx,
+			HedgeAfter: -time.Second,
+		},
+		err: `HedgeAfter of -1s not valid`,
+	}, {
+		args: retry.CallArgs{
+			FuncCtx:    funcCtx,
+			HedgeAfter: time.Second,
+			MaxHedges:  -1,
+		},
+		err: `MaxHedges of -1 not valid`,
+	}, {
+		args: retry.CallArgs{
+			FuncCtx:   funcCtx,
+			MaxHedges: 2,
+		},
+		err: `MaxHedges without HedgeAfter not valid`,
+	}} {
+		c.Logf("test %d", i)
+		test.args.Attempts = 3
+		test.args.Delay = time.Minute
+		err := retry.Call(test.args)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"time"
+)
+
+// Metrics is the interface that the Metrics of the CallArgs must implement
+// to be told what the retry loop is doing. It allows counters and
+// histograms to be kept with any metrics library, without the retry
+// package depending on one. The methods are called from the goroutine that
+// called Call, so a Metrics shared between calls must be safe for
+// concurrent use.
+type Metrics interface {
+	// AttemptStarted is called before each call to Func.
+	AttemptStarted()
+
+	// AttemptFailed is called with the error each time Func fails.
+	AttemptFailed(err error)
+
+	// Delayed is called with the delay each time the loop waits before
+	// another attempt.
+	Delayed(delay time.Duration)
+
+	// Succeeded is called with the number of attempts made when Func
+	// succeeds.
+	Succeeded(attempts int)
+
+	// GaveUp is called when the loop ends without Func succeeding, with the
+	// reason, which is the String of the Status that CallStats would
+	// report, such as "attempts exceeded".
+	GaveUp(reason string)
+}
+
+// metricsOutcome tells the Metrics the result of the retry loop.
+func (args *CallArgs) metricsOutcome(attempts int, err error) {
+	if args.Metrics == nil {
+		return
+	}
+	if err == nil {
+		args.Metrics.Succeeded(attempts)
+		return
+	}
+	args.Metrics.GaveUp(statusOf(attempts, err).String())
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type metricsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&metricsSuite{})
+
+// counterMetrics is an example of a retry.Metrics adapter, which keeps
+// counters by name in the way that a metrics library would.
+type counterMetrics struct {
+	mu       sync.Mutex
+	counters map[string]int
+	delays   []time.Duration
+}
+
+var _ retry.Metrics = (*counterMetrics)(nil)
+
+func newCounterMetrics() *counterMetrics {
+	return &counterMetrics{counters: make(map[string]int)}
+}
+
+func (m *counterMetrics) inc(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name]++
+}
+
+func (m *counterMetrics) AttemptStarted() {
+	m.inc("attempts")
+}
+
+func (m *counterMetrics) AttemptFailed(err error) {
+	m.inc("failures")
+}
+
+func (m *counterMetrics) Delayed(delay time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.delays = append(m.delays, delay)
+}
+
+func (m *counterMetrics) Succeeded(attempts int) {
+	m.inc("successes")
+}
+
+func (m *counterMetrics) GaveUp(reason string) {
+	m.inc("gave up: " + reason)
+}
+
+func (*metricsSuite) TestSucceeded(c *gc.C) {
+	metrics := newCounterMetrics()
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count < 3 {
+				return errors.New("bah")
+			}
+			return nil
+		},
+		Attempts:      5,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		Clock:         &mockClock{},
+		Metrics:       metrics,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(metrics.counters, jc.DeepEquals, map[string]int{
+		"attempts":  3,
+		"failures":  2,
+		"successes": 1,
+	})
+	c.Assert(metrics.delays, jc.DeepEquals, []time.Duration{time.Minute, 2 * time.Minute})
+}
+
+func (*metricsSuite) TestGaveUp(c *gc.C) {
+	metrics := newCounterMetrics()
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+		Metrics:  metrics,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(metrics.counters, jc.DeepEquals, map[string]int{
+		"attempts":                   3,
+		"failures":                   3,
+		"gave up: attempts exceeded": 1,
+	})
+	c.Assert(metrics.delays, gc.HasLen, 2)
+}
+
+func (*metricsSuite) TestGaveUpSingleAttempt(c *gc.C) {
+	metrics := newCounterMetrics()
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 1,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+		Metrics:  metrics,
+	})
+	c.Assert(err, gc.ErrorMatches, "bah")
+	c.Assert(metrics.counters, jc.DeepEquals, map[string]int{
+		"attempts":                   1,
+		"failures":                   1,
+		"gave up: attempts exceeded": 1,
+	})
+}
+
+func (*metricsSuite) TestGaveUpNotValid(c *gc.C) {
+	metrics := newCounterMetrics()
+	err := retry.Call(retry.CallArgs{
+		Func:    func() error { return nil },
+		Metrics: metrics,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(metrics.counters, jc.DeepEquals, map[string]int{
+		"gave up: not valid": 1,
+	})
+}
+
+func (*metricsSuite) TestFatal(c *gc.C) {
+	metrics := newCounterMetrics()
+	err := retry.Call(retry.CallArgs{
+		Func:         func() error { return errors.New("fatal") },
+		IsFatalError: func(error) bool { return true },
+		Attempts:     3,
+		Delay:        time.Minute,
+		Clock:        &mockClock{},
+		Metrics:      metrics,
+	})
+	c.Assert(err, gc.ErrorMatches, "fatal")
+	c.Assert(metrics.counters, jc.DeepEquals, map[string]int{
+		"attempts":        1,
+		"failures":        1,
+		"gave up: failed": 1,
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"sync"
+)
+
+// Pauser can pause and resume any number of retry loops that have it as
+// their Pauser, for instance during a maintenance window. The zero value is
+// a Pauser that is not paused. A Pauser is safe to use from many goroutines
+// at once.
+type Pauser struct {
+	mu sync.Mutex
+	// resumed is closed when the Pauser is resumed. It is nil when the
+	// Pauser is not paused.
+	resumed chan struct{}
+}
+
+// Pause pauses the retry loops using the Pauser, until Resume is called.
+// Pausing a Pauser that is already paused does nothing.
+func (p *Pauser) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+	}
+}
+
+// Resume lets the retry loops using the Pauser carry on. Resuming a Pauser
+// that is not paused does nothing.
+func (p *Pauser) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+	}
+}
+
+// Paused returns true if the Pauser is paused.
+func (p *Pauser) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+// wait waits while the Pauser is paused, unless interrupted by the Stop
+// channel, Canceller or Context of the CallArgs.
+func (p *Pauser) wait(args *CallArgs) sleepResult {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+	if resumed == nil {
+		return sleepCompleted
+	}
+	stop, cancelled, done := args.stopChannels()
+	select {
+	case <-resumed:
+		return sleepCompleted
+	case <-stop:
+		return sleepStopped
+	case <-cancelled:
+		return sleepStopped
+	case <-done:
+		return sleepCancelled
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+	"github.com/juju/retry/retrytest"
+)
+
+type pauserSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&pauserSuite{})
+
+func (*pauserSuite) TestPauseResume(c *gc.C) {
+	var pauser retry.Pauser
+	c.Assert(pauser.Paused(), jc.IsFalse)
+	pauser.Pause()
+	pauser.Pause()
+	c.Assert(pauser.Paused(), jc.IsTrue)
+	pauser.Resume()
+	c.Assert(pauser.Paused(), jc.IsFalse)
+	pauser.Resume()
+	c.Assert(pauser.Paused(), jc.IsFalse)
+}
+
+func (*pauserSuite) TestPaused(c *gc.C) {
+	pauser := &retry.Pauser{}
+	pauser.Pause()
+	clock := retrytest.NewClock(time.Now())
+	failed := make(chan int, 3)
+	result := callInBackground(retry.CallArgs{
+		Func:       func() error { return errors.New("bah") },
+		NotifyFunc: func(_ error, attempt int) { failed <- attempt },
+		Attempts:   3,
+		Delay:      time.Minute,
+		Pauser:     pauser,
+		Clock:      clock,
+	})
+	// The first attempt is made, but the loop doesn't start waiting for the
+	// delay while it is paused.
+	select {
+	case attempt := <-failed:
+		c.Assert(attempt, gc.Equals, 1)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("first attempt not made")
+	}
+	select {
+	case <-result:
+		c.Fatalf("Call returned while paused")
+	case <-time.After(testing.ShortWait):
+	}
+	c.Assert(clock.Delays(), gc.HasLen, 0)
+
+	pauser.Resume()
+	c.Assert(clock.WaitAdvance(time.Minute, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(clock.WaitAdvance(time.Minute, testing.LongWait, 1), jc.ErrorIsNil)
+	c.Assert(errors.Cause(waitForResult(c, result)), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.Delays(), jc.DeepEquals, []time.Duration{time.Minute, time.Minute})
+}
+
+func (*pauserSuite) TestStopWhilePaused(c *gc.C) {
+	pauser := &retry.Pauser{}
+	pauser.Pause()
+	stop := make(chan struct{})
+	var willRetry []bool
+	err := retry.Call(retry.CallArgs{
+		Func:       func() error { return errors.New("bah") },
+		NotifyFunc: func(error, int) { close(stop) },
+		NotifyFuncV2: func(_ error, _ int, retrying, _ bool) {
+			willRetry = append(willRetry, retrying)
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Pauser:   pauser,
+		Stop:     stop,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(pauser.Paused(), jc.IsTrue)
+	// The failure is still reported, although there is no retry.
+	c.Assert(willRetry, jc.DeepEquals, []bool{false})
+}
+
+func (*pauserSuite) TestPausedTimeCountsTowardsMaxDuration(c *gc.C) {
+	pauser := &retry.Pauser{}
+	pauser.Pause()
+	clock := retrytest.NewClock(time.Now())
+	failed := make(chan struct{}, 1)
+	result := callInBackground(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		NotifyFunc:  func(error, int) { failed <- struct{}{} },
+		Attempts:    retry.UnlimitedAttempts,
+		Delay:       time.Minute,
+		MaxDuration: time.Hour,
+		Pauser:      pauser,
+		Clock:       clock,
+	})
+	select {
+	case <-failed:
+	case <-time.After(testing.LongWait):
+		c.Fatalf("first attempt not made")
+	}
+	clock.Advance(2 * time.Hour)
+	pauser.Resume()
+	err := waitForResult(c, result)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(clock.Delays(), gc.HasLen, 0)
+}
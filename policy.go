@@ -0,0 +1,108 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Policy is the part of the CallArgs that describes how often to retry,
+// in a form that can be stored as JSON, such as in a config file. The
+// durations are written in the form used by time.Duration.String, such as
+// "1m30s".
+type Policy struct {
+	Attempts      int
+	Delay         time.Duration
+	BackoffFactor float64
+	MaxDelay      time.Duration
+	MinDelay      time.Duration
+}
+
+// PolicyFromCallArgs returns the Policy of the CallArgs. Fields of the
+// CallArgs that are not part of a Policy are ignored.
+func PolicyFromCallArgs(args CallArgs) Policy {
+	return Policy{
+		Attempts:      args.Attempts,
+		Delay:         args.Delay,
+		BackoffFactor: args.BackoffFactor,
+		MaxDelay:      args.MaxDelay,
+		MinDelay:      args.MinDelay,
+	}
+}
+
+// ToCallArgs returns CallArgs with the fields of the Policy set. The Func,
+// and anything else that cannot be stored, still needs to be set.
+func (p Policy) ToCallArgs() CallArgs {
+	return CallArgs{
+		Attempts:      p.Attempts,
+		Delay:         p.Delay,
+		BackoffFactor: p.BackoffFactor,
+		MaxDelay:      p.MaxDelay,
+		MinDelay:      p.MinDelay,
+	}
+}
+
+// jsonPolicy is how a Policy is stored, with the durations as strings.
+type jsonPolicy struct {
+	Attempts      int     `json:"attempts"`
+	Delay         string  `json:"delay"`
+	BackoffFactor float64 `json:"backoff-factor,omitempty"`
+	MaxDelay      string  `json:"max-delay,omitempty"`
+	MinDelay      string  `json:"min-delay,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p Policy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonPolicy{
+		Attempts:      p.Attempts,
+		Delay:         p.Delay.String(),
+		BackoffFactor: p.BackoffFactor,
+		MaxDelay:      durationString(p.MaxDelay),
+		MinDelay:      durationString(p.MinDelay),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	var in jsonPolicy
+	if err := json.Unmarshal(data, &in); err != nil {
+		return errors.Trace(err)
+	}
+	policy := Policy{
+		Attempts:      in.Attempts,
+		BackoffFactor: in.BackoffFactor,
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		out   *time.Duration
+	}{
+		{"delay", in.Delay, &policy.Delay},
+		{"max-delay", in.MaxDelay, &policy.MaxDelay},
+		{"min-delay", in.MinDelay, &policy.MinDelay},
+	} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return errors.Annotatef(err, "parsing %s", d.name)
+		}
+		*d.out = duration
+	}
+	*p = policy
+	return nil
+}
+
+// durationString returns the duration as a string, or an empty string if it
+// is zero, so that it can be omitted.
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
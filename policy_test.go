@@ -0,0 +1,85 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type policySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&policySuite{})
+
+func (*policySuite) TestMarshal(c *gc.C) {
+	policy := retry.Policy{
+		Attempts:      5,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		MaxDelay:      90 * time.Second,
+		MinDelay:      500 * time.Millisecond,
+	}
+	data, err := json.Marshal(policy)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, `{"attempts":5,"delay":"1s","backoff-factor":2,"max-delay":"1m30s","min-delay":"500ms"}`)
+
+	var out retry.Policy
+	err = json.Unmarshal(data, &out)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out, jc.DeepEquals, policy)
+}
+
+func (*policySuite) TestMarshalOmitsUnset(c *gc.C) {
+	data, err := json.Marshal(retry.Policy{Attempts: 3, Delay: time.Minute})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, `{"attempts":3,"delay":"1m0s"}`)
+}
+
+func (*policySuite) TestUnmarshalNotValid(c *gc.C) {
+	var policy retry.Policy
+	err := json.Unmarshal([]byte(`{"attempts":3,"delay":"1m","max-delay":"soon"}`), &policy)
+	c.Assert(err, gc.ErrorMatches, `parsing max-delay: time: invalid duration "soon"`)
+}
+
+func (*policySuite) TestCallArgs(c *gc.C) {
+	args := retry.CallArgs{
+		Func:          func() error { return nil },
+		Attempts:      5,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		MaxDelay:      time.Minute,
+		MinDelay:      time.Millisecond,
+		MaxDuration:   time.Hour,
+	}
+	policy := retry.PolicyFromCallArgs(args)
+	c.Assert(policy, jc.DeepEquals, retry.Policy{
+		Attempts:      5,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		MaxDelay:      time.Minute,
+		MinDelay:      time.Millisecond,
+	})
+
+	clock := &mockClock{}
+	args = policy.ToCallArgs()
+	args.Func = func() error { return errors.New("bah") }
+	args.Clock = clock
+	err := retry.Call(args)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	stderrors "errors"
+)
+
+// FatalWhenIs returns a function for use as the IsFatalError of the
+// CallArgs, that treats an error as fatal if it matches any of the targets
+// according to errors.Is.
+func FatalWhenIs(targets ...error) func(error) bool {
+	return func(err error) bool {
+		return isAny(err, targets)
+	}
+}
+
+// RetryWhenIs returns a function for use as the IsRetryableError of the
+// CallArgs, that only allows an error to be retried if it matches any of the
+// targets according to errors.Is.
+func RetryWhenIs(targets ...error) func(error) bool {
+	return func(err error) bool {
+		return isAny(err, targets)
+	}
+}
+
+// FatalWhenAs returns a function for use as the IsFatalError of the
+// CallArgs, that treats an error as fatal if any error in its chain is of
+// type T, according to errors.As.
+func FatalWhenAs[T error]() func(error) bool {
+	return func(err error) bool {
+		var target T
+		return stderrors.As(err, &target)
+	}
+}
+
+// OnStatusCodes returns a function for use as the IsRetryableError of the
+// CallArgs, that only allows an error to be retried if an error in its chain
+// has a StatusCode method, such as an error from an HTTP client, returning
+// one of the codes. An error without a status code is not retried.
+func OnStatusCodes(codes ...int) func(error) bool {
+	return func(err error) bool {
+		var coder statusCoder
+		if !stderrors.As(err, &coder) {
+			return false
+		}
+		code := coder.StatusCode()
+		for _, c := range codes {
+			if code == c {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// statusCoder is implemented by errors that carry a status code.
+type statusCoder interface {
+	StatusCode() int
+}
+
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if stderrors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
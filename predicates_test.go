@@ -0,0 +1,109 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type predicatesSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&predicatesSuite{})
+
+func (*predicatesSuite) TestFatalWhenIs(c *gc.C) {
+	isFatal := retry.FatalWhenIs(io.EOF, os.ErrNotExist)
+	c.Check(isFatal(io.EOF), jc.IsTrue)
+	c.Check(isFatal(fmt.Errorf("reading: %w", os.ErrNotExist)), jc.IsTrue)
+	c.Check(isFatal(errors.Trace(io.EOF)), jc.IsTrue)
+	c.Check(isFatal(io.ErrUnexpectedEOF), jc.IsFalse)
+	c.Check(retry.FatalWhenIs()(io.EOF), jc.IsFalse)
+}
+
+func (*predicatesSuite) TestRetryWhenIs(c *gc.C) {
+	isRetryable := retry.RetryWhenIs(io.ErrUnexpectedEOF)
+	c.Check(isRetryable(fmt.Errorf("reading: %w", io.ErrUnexpectedEOF)), jc.IsTrue)
+	c.Check(isRetryable(io.EOF), jc.IsFalse)
+}
+
+func (*predicatesSuite) TestFatalWhenAs(c *gc.C) {
+	isFatal := retry.FatalWhenAs[*os.PathError]()
+	pathErr := &os.PathError{Op: "open", Path: "/foo", Err: os.ErrNotExist}
+	c.Check(isFatal(pathErr), jc.IsTrue)
+	c.Check(isFatal(fmt.Errorf("opening: %w", pathErr)), jc.IsTrue)
+	c.Check(isFatal(os.ErrNotExist), jc.IsFalse)
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d", e.code)
+}
+
+func (e *statusError) StatusCode() int {
+	return e.code
+}
+
+func (*predicatesSuite) TestOnStatusCodes(c *gc.C) {
+	isRetryable := retry.OnStatusCodes(429, 503)
+	c.Check(isRetryable(&statusError{503}), jc.IsTrue)
+	c.Check(isRetryable(fmt.Errorf("getting: %w", &statusError{429})), jc.IsTrue)
+	c.Check(isRetryable(errors.Annotate(&statusError{429}, "getting")), jc.IsTrue)
+	c.Check(isRetryable(&statusError{500}), jc.IsFalse)
+	c.Check(isRetryable(io.EOF), jc.IsFalse)
+	c.Check(retry.OnStatusCodes()(&statusError{503}), jc.IsFalse)
+}
+
+func (*predicatesSuite) TestOnStatusCodesWithCall(c *gc.C) {
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count < 3 {
+				return &statusError{503}
+			}
+			return &statusError{400}
+		},
+		IsRetryableError: retry.OnStatusCodes(503),
+		Attempts:         5,
+		Delay:            time.Minute,
+		Clock:            &mockClock{},
+	})
+	c.Assert(err, gc.ErrorMatches, `status 400`)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (*predicatesSuite) TestWithCall(c *gc.C) {
+	clock := &mockClock{}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count < 3 {
+				return io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("reading: %w", io.EOF)
+		},
+		IsFatalError: retry.FatalWhenIs(io.EOF),
+		Attempts:     5,
+		Delay:        time.Minute,
+		Clock:        clock,
+	})
+	c.Assert(err, gc.ErrorMatches, `reading: EOF`)
+	c.Assert(count, gc.Equals, 3)
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
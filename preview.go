@@ -0,0 +1,201 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Preview describes what a retry loop would do if every attempt failed.
+type Preview struct {
+	// Attempts is the number of times Func would be called.
+	Attempts int
+
+	// Delays are the waits between the attempts, and the wait after the
+	// final attempt if IncludeFinalDelay is set.
+	Delays []time.Duration
+
+	// WorstCase is the longest that the retry loop could take. It is the
+	// InitialDelay and the Delays added together, along with the
+	// AttemptTimeout for every attempt if that is set. Without an
+	// AttemptTimeout, the time spent in Func is not included, as it cannot
+	// be known.
+	WorstCase time.Duration
+
+	// Unbounded is true if the Attempts is UnlimitedAttempts, so that the
+	// number of attempts is only limited by the MaxDuration. In that case
+	// Attempts is the most attempts that fit in the MaxDuration, which is
+	// fewer if Func takes any time.
+	Unbounded bool
+}
+
+// Preview returns what the retry loop would do if every attempt failed,
+// without calling the Func or using the Clock. The defaults given to
+// SetDefaults are applied and the CallArgs are validated as they would be by
+// Call, except that a Func does not need to be set.
+//
+// The delays are those from the BackoffFactor, BackoffFunc or Schedule,
+// limited by the MinDelay, MaxDelay, MaxDelayedAttempts and MaxDuration.
+// Each delay is at least the MinInterval less the AttemptTimeout, as Func
+// is taken to use up the AttemptTimeout, or no time if there isn't one.
+// Jitter on the delay can only make it shorter, so it is ignored, but the
+// BackoffFactorJitter can make the delays longer, so the BackoffFactor is
+// taken at its largest, of `factor * (1 + BackoffFactorJitter)`. The
+// MaxDelayFraction is applied, but the DelayFunc, BackoffForError and
+// RetryAfter are not, as they depend on the errors returned.
+//
+// The Deadline is ignored, along with a MaxDelayFraction that applies to
+// it, as it depends on the time from the Clock.
+//
+// If Attempts is UnlimitedAttempts, a MaxDuration must be set to bound the
+// loop, and every delay must be more than zero unless an AttemptTimeout is
+// set, so that the MaxDuration is used up.
+func (args *CallArgs) Preview() (Preview, error) {
+	policy := args.Clone()
+	policy.applyDefaults()
+	if policy.Func == nil && policy.FuncWithAttempt == nil && policy.FuncCtx == nil {
+		policy.Func = func() error { return nil }
+	}
+	// The default Clock is set by Validate, but never used here.
+	if err := policy.Validate(); err != nil {
+		return Preview{}, errors.Trace(err)
+	}
+	unbounded := policy.Attempts == UnlimitedAttempts
+	if unbounded && policy.MaxDuration <= 0 {
+		return Preview{}, errors.NotValidf("UnlimitedAttempts without MaxDuration")
+	}
+	preview := Preview{Unbounded: unbounded}
+	elapsed := policy.InitialDelay
+	delay := policy.Delay
+	delayed := 0
+	factor := policy.BackoffFactor * (1 + policy.BackoffFactorJitter)
+	for i := 1; unbounded || i <= policy.Attempts; i++ {
+		preview.Attempts = i
+		elapsed += policy.AttemptTimeout
+		final := i == policy.Attempts
+		if final && !policy.IncludeFinalDelay {
+			break
+		}
+		delay = policy.backoff(delay, i, factor)
+		wait := delay
+		// limited is true if the MaxDelayFraction has used up the delay.
+		limited := false
+		if policy.MaxDelayFraction > 0 && policy.MaxDuration > 0 {
+			limit := time.Duration(policy.MaxDelayFraction * float64(policy.MaxDuration-elapsed))
+			if wait > limit {
+				wait = ClampDuration(limit, 0, 0)
+				limited = wait <= 0
+			}
+		}
+		if policy.MaxDelayedAttempts > 0 && delayed >= policy.MaxDelayedAttempts {
+			wait = 0
+		}
+		if gap := policy.MinInterval - policy.AttemptTimeout; wait < gap {
+			wait = gap
+		}
+		if wait > 0 {
+			delayed++
+		}
+		if policy.MaxDuration > 0 && wait > policy.MaxDuration-elapsed {
+			break
+		}
+		if unbounded && (limited || policy.MaxDuration-elapsed <= 0) {
+			// The fraction of the time left has shrunk to nothing, so the
+			// loop ends once the Func has used up the rest of the time.
+			break
+		}
+		if unbounded && wait <= 0 && policy.AttemptTimeout <= 0 {
+			return Preview{}, errors.NotValidf("UnlimitedAttempts with a delay of zero")
+		}
+		preview.Delays = append(preview.Delays, wait)
+		elapsed += wait
+		if final {
+			break
+		}
+	}
+	preview.WorstCase = elapsed
+	return preview, nil
+}
+
+// totalDelay returns the sum of the delays between attempts if every
+// attempt failed, and the number of attempts.
+func (args *CallArgs) totalDelay() (time.Duration, int, error) {
+	preview, err := args.Preview()
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	var total time.Duration
+	for _, delay := range preview.Delays {
+		total += delay
+	}
+	return total, preview.Attempts, nil
+}
+
+// CapToTotal returns a copy of the CallArgs with the MaxDelay set so that,
+// if every attempt failed, the delays between the attempts would add up to
+// no more than the total. The delays are worked out as they are by
+// Preview, and the largest MaxDelay that keeps within the total is used,
+// so the backoff is only flattened where it has to be. If the delays
+// already fit, the CallArgs are returned unchanged.
+//
+// The MaxDelay is not set below the Delay or MinDelay, and it cannot
+// bring a delay below the one the MinInterval needs, so an error
+// satisfying errors.IsNotValid is returned if the delays don't fit even
+// when every one is capped at those, or if the Attempts is
+// UnlimitedAttempts, as then there is no end to the delays.
+func CapToTotal(args CallArgs, total time.Duration) (CallArgs, error) {
+	// The bounds come from the CallArgs as Call would see them, but only
+	// the MaxDelay is set in the copy returned, so that later defaults
+	// still apply to it.
+	withDefaults := args.Clone()
+	withDefaults.applyDefaults()
+	if withDefaults.Attempts == UnlimitedAttempts {
+		return CallArgs{}, errors.NotValidf("CapToTotal with UnlimitedAttempts")
+	}
+	sum, attempts, err := args.totalDelay()
+	if err != nil {
+		return CallArgs{}, errors.Trace(err)
+	}
+	if sum <= total {
+		return args, nil
+	}
+	capped := args.Clone()
+	// A MaxDelay of zero means no cap at all, so the smallest cap there can
+	// be is a nanosecond, as for a Schedule, where there is no Delay.
+	low := time.Duration(1)
+	if withDefaults.Delay > low {
+		low = withDefaults.Delay
+	}
+	if withDefaults.MinDelay > low {
+		low = withDefaults.MinDelay
+	}
+	capped.MaxDelay = low
+	if sum, _, err = capped.totalDelay(); err != nil {
+		return CallArgs{}, errors.Trace(err)
+	}
+	if sum > total {
+		return CallArgs{}, errors.NotValidf("total delay of %v with attempts of %d", total, attempts)
+	}
+	// Search for the largest MaxDelay that fits, knowing that low fits and
+	// that a MaxDelay of the total, or the MaxDelay already set, does not.
+	high := total
+	if withDefaults.MaxDelay > 0 && withDefaults.MaxDelay < high {
+		high = withDefaults.MaxDelay
+	}
+	for low < high {
+		capped.MaxDelay = low + (high-low+1)/2
+		if sum, _, err = capped.totalDelay(); err != nil {
+			return CallArgs{}, errors.Trace(err)
+		}
+		if sum <= total {
+			low = capped.MaxDelay
+		} else {
+			high = capped.MaxDelay - 1
+		}
+	}
+	capped.MaxDelay = low
+	return capped, nil
+}
@@ -0,0 +1,353 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type previewSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&previewSuite{})
+
+// panicClock is a Clock that fails the test if it is used.
+type panicClock struct{}
+
+func (panicClock) Now() time.Time {
+	panic("Now called")
+}
+
+func (panicClock) After(time.Duration) <-chan time.Time {
+	panic("After called")
+}
+
+func (*previewSuite) TestAttempts(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:      5,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		MaxDelay:      5 * time.Second,
+		InitialDelay:  time.Minute,
+		Jitter:        true,
+		Clock:         panicClock{},
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  5,
+		Delays:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		WorstCase: time.Minute + 12*time.Second,
+	})
+}
+
+func (*previewSuite) TestAttemptTimeout(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:       3,
+		Delay:          time.Second,
+		AttemptTimeout: 10 * time.Second,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  3,
+		Delays:    []time.Duration{time.Second, time.Second},
+		WorstCase: 32 * time.Second,
+	})
+}
+
+func (*previewSuite) TestMaxDuration(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:      10,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		MaxDuration:   10 * time.Minute,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	// The next delay of 8 minutes would pass the MaxDuration.
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  4,
+		Delays:    []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute},
+		WorstCase: 7 * time.Minute,
+	})
+}
+
+func (*previewSuite) TestUnlimitedAttempts(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:    retry.UnlimitedAttempts,
+		Delay:       time.Minute,
+		MaxDuration: 3*time.Minute + 30*time.Second,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  4,
+		Delays:    []time.Duration{time.Minute, time.Minute, time.Minute},
+		WorstCase: 3 * time.Minute,
+		Unbounded: true,
+	})
+}
+
+func (*previewSuite) TestSchedule(c *gc.C) {
+	args := retry.CallArgs{
+		Schedule: []time.Duration{time.Second, time.Minute},
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  3,
+		Delays:    []time.Duration{time.Second, time.Minute},
+		WorstCase: time.Minute + time.Second,
+	})
+	c.Assert(args.Attempts, gc.Equals, 0)
+}
+
+func (*previewSuite) TestUnlimitedAttemptsWithoutMaxDuration(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts: retry.UnlimitedAttempts,
+		Delay:    time.Minute,
+	}
+	_, err := args.Preview()
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `UnlimitedAttempts without MaxDuration not valid`)
+}
+
+func (*previewSuite) TestUnlimitedAttemptsZeroDelay(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:    retry.UnlimitedAttempts,
+		Schedule:    []time.Duration{time.Second, 0},
+		MaxDuration: time.Minute,
+	}
+	_, err := args.Preview()
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `UnlimitedAttempts with a delay of zero not valid`)
+}
+
+func (*previewSuite) TestBackoffFactorJitter(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:            4,
+		Delay:               time.Second,
+		BackoffFactor:       2,
+		BackoffFactorJitter: 0.5,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	// The BackoffFactor is taken at its largest, of 3.
+	c.Assert(preview.Delays, jc.DeepEquals, []time.Duration{
+		time.Second, 3 * time.Second, 9 * time.Second,
+	})
+	c.Assert(preview.WorstCase, gc.Equals, 13*time.Second)
+}
+
+func (*previewSuite) TestMinInterval(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:    3,
+		MinInterval: time.Second,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  3,
+		Delays:    []time.Duration{time.Second, time.Second},
+		WorstCase: 2 * time.Second,
+	})
+	// The Func is taken to use up the AttemptTimeout, which counts towards
+	// the MinInterval.
+	args.AttemptTimeout = 400 * time.Millisecond
+	preview, err = args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  3,
+		Delays:    []time.Duration{600 * time.Millisecond, 600 * time.Millisecond},
+		WorstCase: 2400 * time.Millisecond,
+	})
+}
+
+func (*previewSuite) TestUnlimitedAttemptsMinInterval(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:    retry.UnlimitedAttempts,
+		MinInterval: time.Minute,
+		MaxDuration: 3*time.Minute + 30*time.Second,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  4,
+		Delays:    []time.Duration{time.Minute, time.Minute, time.Minute},
+		WorstCase: 3 * time.Minute,
+		Unbounded: true,
+	})
+}
+
+func (*previewSuite) TestMaxDelayedAttempts(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:           5,
+		Delay:              time.Second,
+		MaxDelayedAttempts: 2,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  5,
+		Delays:    []time.Duration{time.Second, time.Second, 0, 0},
+		WorstCase: 2 * time.Second,
+	})
+}
+
+func (*previewSuite) TestDeadlineMaxDelayFraction(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:         3,
+		Delay:            time.Second,
+		Deadline:         time.Now().Add(time.Hour),
+		MaxDelayFraction: 0.5,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview.Delays, jc.DeepEquals, []time.Duration{time.Second, time.Second})
+}
+
+func (*previewSuite) TestIncludeFinalDelay(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:          3,
+		Delay:             time.Second,
+		BackoffFactor:     2,
+		IncludeFinalDelay: true,
+	}
+	preview, err := args.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview, jc.DeepEquals, retry.Preview{
+		Attempts:  3,
+		Delays:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		WorstCase: 7 * time.Second,
+	})
+}
+
+func (*previewSuite) TestNotValid(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts: 3,
+	}
+	_, err := args.Preview()
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `missing Delay not valid`)
+}
+
+func (*previewSuite) TestCapToTotal(c *gc.C) {
+	args := retry.CallArgs{
+		Func:          func() error { return nil },
+		Attempts:      5,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+	}
+	capped, err := retry.CapToTotal(args, 10*time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	// The uncapped delays of 1s, 2s, 4s and 8s are flattened at the end.
+	c.Assert(capped.MaxDelay, gc.Equals, 3500*time.Millisecond)
+	preview, err := capped.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview.Delays, jc.DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 3500 * time.Millisecond, 3500 * time.Millisecond,
+	})
+	// The original CallArgs are left alone.
+	c.Assert(args.MaxDelay, gc.Equals, time.Duration(0))
+}
+
+func (*previewSuite) TestCapToTotalAlreadyFits(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:      5,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		MaxDelay:      2 * time.Second,
+	}
+	capped, err := retry.CapToTotal(args, time.Minute)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(capped.MaxDelay, gc.Equals, 2*time.Second)
+}
+
+func (*previewSuite) TestCapToTotalMinInterval(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:      5,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		MinInterval:   2 * time.Second,
+	}
+	capped, err := retry.CapToTotal(args, 10*time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	// The MinInterval raises the first delay to 2s, leaving less room for
+	// the rest.
+	c.Assert(capped.MaxDelay, gc.Equals, 3*time.Second)
+	preview, err := capped.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview.Delays, jc.DeepEquals, []time.Duration{
+		2 * time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second,
+	})
+
+	_, err = retry.CapToTotal(args, 7*time.Second)
+	c.Check(err, gc.ErrorMatches, `total delay of 7s with attempts of 5 not valid`)
+}
+
+func (*previewSuite) TestCapToTotalNotValid(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:      5,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+	}
+	// Even capped at the Delay, the four delays add up to 4s.
+	_, err := retry.CapToTotal(args, 3*time.Second)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `total delay of 3s with attempts of 5 not valid`)
+
+	args.MinDelay = 2 * time.Second
+	_, err = retry.CapToTotal(args, 7*time.Second)
+	c.Check(err, gc.ErrorMatches, `total delay of 7s with attempts of 5 not valid`)
+
+	args.Attempts = retry.UnlimitedAttempts
+	_, err = retry.CapToTotal(args, time.Minute)
+	c.Check(err, gc.ErrorMatches, `CapToTotal with UnlimitedAttempts not valid`)
+}
+
+func (*previewSuite) TestUnlimitedAttemptsMaxDelayFraction(c *gc.C) {
+	for i, fraction := range []float64{0.5, 1} {
+		c.Logf("test %d: fraction %v", i, fraction)
+		args := retry.CallArgs{
+			Attempts:         retry.UnlimitedAttempts,
+			Delay:            time.Minute,
+			MaxDuration:      2 * time.Minute,
+			MaxDelayFraction: fraction,
+		}
+		// The delays shrink with the time left, rather than running on
+		// with zero delays.
+		preview, err := args.Preview()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(preview.Unbounded, jc.IsTrue)
+		c.Check(preview.WorstCase <= 2*time.Minute, jc.IsTrue)
+		c.Check(preview.Attempts, gc.Equals, len(preview.Delays)+1)
+	}
+}
+
+func (*previewSuite) TestCapToTotalSchedule(c *gc.C) {
+	args := retry.CallArgs{
+		Schedule: []time.Duration{time.Second, time.Minute, time.Hour},
+	}
+	capped, err := retry.CapToTotal(args, 10*time.Minute)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(capped.MaxDelay, gc.Equals, 8*time.Minute+59*time.Second)
+	preview, err := capped.Preview()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(preview.Delays, jc.DeepEquals, []time.Duration{
+		time.Second, time.Minute, 8*time.Minute + 59*time.Second,
+	})
+
+	// The attempts reported are those that the Schedule gives.
+	_, err = retry.CapToTotal(args, 2*time.Nanosecond)
+	c.Assert(err, gc.ErrorMatches, `total delay of 2ns with attempts of 4 not valid`)
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Repeat calls the Func over and over, like a ticker that backs off when
+// things go wrong. Once the Func succeeds, Repeat waits for the interval
+// before calling it again. If the Func fails, it is retried as it would be
+// by Call, using the Delay, BackoffFactor and the rest of the args, and once
+// it succeeds the backoff is reset, so that the next failure starts again
+// from the Delay. The interval is measured from when the Func succeeds, so
+// the time between calls is the interval plus the time the Func takes. The
+// InitialDelay and SpreadFirstAttempt are only waited for before the first
+// call.
+//
+// If Attempts is not set, failures are retried forever. Otherwise, if the
+// Func fails for all the attempts, Repeat returns the same error as Call.
+// Repeat also stops on a fatal error, or when the Stop channel, Canceller or
+// Context stop it, so it only ever returns an error. If it is stopped while
+// waiting for the interval, a RetryStopped error is returned for the Stop
+// channel or Canceller, and the error of the Context if that is done.
+func Repeat(args CallArgs, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.NotValidf("interval of %v", interval)
+	}
+	args.applyDefaults()
+	if args.Attempts == 0 {
+		args.Attempts = UnlimitedAttempts
+	}
+	if err := args.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if args.Stop == nil && args.Canceller == nil && args.Context == nil {
+		args.Context = DefaultContext
+	}
+	start := args.Clock.Now()
+	for {
+		if err := Call(args); err != nil {
+			return errors.Trace(err)
+		}
+		args.InitialDelay = 0
+		args.SpreadFirstAttempt = 0
+		switch args.sleep(interval) {
+		case sleepStopped:
+			return &RetryStopped{Elapsed: args.Clock.Now().Sub(start)}
+		case sleepCancelled:
+			return errors.Trace(args.Context.Err())
+		case sleepBrokenClock:
+			return brokenClock()
+		}
+	}
+}
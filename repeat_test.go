@@ -0,0 +1,132 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type repeatSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&repeatSuite{})
+
+func (*repeatSuite) TestRepeat(c *gc.C) {
+	clock := &mockClock{}
+	stop := make(chan struct{})
+	// Each run fails the given number of times before succeeding.
+	failures := []int{0, 2, 1, 0}
+	count := 0
+	err := retry.Repeat(retry.CallArgs{
+		Func: func() error {
+			count++
+			if failures[0] > 0 {
+				failures[0]--
+				return errors.New("bah")
+			}
+			failures = failures[1:]
+			if len(failures) == 0 {
+				close(stop)
+			}
+			return nil
+		},
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		InitialDelay:  time.Hour,
+		Stop:          stop,
+		Clock:         clock,
+	}, time.Minute)
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(count, gc.Equals, 7)
+	// The backoff is reset after each success.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Hour,
+		time.Minute,
+		time.Second,
+		2 * time.Second,
+		time.Minute,
+		time.Second,
+		time.Minute,
+		time.Minute,
+	})
+}
+
+func (*repeatSuite) TestRepeatAttemptsExceeded(c *gc.C) {
+	count := 0
+	err := retry.Repeat(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 1 {
+				return nil
+			}
+			return errors.New("bah")
+		},
+		Attempts: 3,
+		Delay:    time.Second,
+		Clock:    &mockClock{},
+	}, time.Minute)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 4)
+}
+
+func (*repeatSuite) TestRepeatFatal(c *gc.C) {
+	fatal := errors.New("fatal")
+	count := 0
+	err := retry.Repeat(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 3 {
+				return fatal
+			}
+			return nil
+		},
+		IsFatalError: func(err error) bool { return err == fatal },
+		Delay:        time.Second,
+		Clock:        &mockClock{},
+	}, time.Minute)
+	c.Assert(errors.Cause(err), gc.Equals, fatal)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (*repeatSuite) TestRepeatContext(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err := retry.Repeat(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 2 {
+				cancel()
+			}
+			return nil
+		},
+		Delay:   time.Second,
+		Context: ctx,
+		Clock:   &mockClock{},
+	}, time.Minute)
+	c.Assert(errors.Cause(err), gc.Equals, context.Canceled)
+	c.Assert(count, gc.Equals, 2)
+}
+
+func (*repeatSuite) TestRepeatNotValid(c *gc.C) {
+	err := retry.Repeat(retry.CallArgs{
+		Func:  func() error { return nil },
+		Delay: time.Second,
+	}, 0)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `interval of 0s not valid`)
+
+	err = retry.Repeat(retry.CallArgs{
+		Func: func() error { return nil },
+	}, time.Minute)
+	c.Assert(err, gc.ErrorMatches, `missing Delay not valid`)
+}
@@ -29,8 +29,14 @@
 package retry
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
 	"math"
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/juju/errors"
@@ -43,25 +49,99 @@ const (
 	UnlimitedAttempts = -1
 )
 
-var (
-	// RetryStopped is the error that is returned from the retry functions
-	// when the stop channel has been closed.
-	RetryStopped = errors.New("retry stopped")
-)
+// DefaultContext is used as the Context of any call that has none of the
+// Stop channel, Canceller or Context set. It allows an application to stop
+// all such retry loops on shutdown, for instance by setting it to a context
+// from signal.NotifyContext when it starts. It defaults to the background
+// context, which is never done, so unless it is changed, calls that have no
+// way to be stopped behave as they always have. It should be set before any
+// retry loops are started, as it is not safe to change while they run.
+var DefaultContext = context.Background()
+
+// RetryStopped is the error that is returned from the retry functions
+// when the stop channel has been closed. The last error returned from the
+// function being retried is available as the LastError attribute, which is
+// nil if the function was never called. Every error returned, in attempt
+// order, is available as the Errors attribute, and the total time spent
+// retrying is available as the Elapsed attribute.
+type RetryStopped struct {
+	LastError error
+	Errors    []error
+	Elapsed   time.Duration
+}
+
+// Error provides the implementation for the error interface method.
+func (e *RetryStopped) Error() string {
+	return "retry stopped"
+}
+
+// Unwrap returns the LastError, so that errors.Is and errors.As can match
+// the error returned from the function being retried.
+func (e *RetryStopped) Unwrap() error {
+	return e.LastError
+}
 
 // AttemptsExceeded is the error that is returned when the retry count has
 // been hit without the function returning a nil error result. The last error
 // returned from the function being retried is available as the LastError
-// attribute.
+// attribute, and every error returned, in attempt order, is available as the
+// Errors attribute. The total time spent retrying, including the delays
+// between attempts, is available as the Elapsed attribute, and the number of
+// attempts made as the Attempts attribute.
 type AttemptsExceeded struct {
 	LastError error
+	Errors    []error
+	Elapsed   time.Duration
+	Attempts  int
+
+	// format is the ErrorFormatter of the CallArgs, if any.
+	format func(lastError error, attempts int) string
+	// joined holds every error if JoinErrors was set.
+	joined *joinedErrors
 }
 
 // Error provides the implementation for the error interface method.
 func (e *AttemptsExceeded) Error() string {
+	if e.format != nil {
+		return e.format(e.LastError, e.Attempts)
+	}
+	if e.joined != nil {
+		return fmt.Sprintf("attempt count exceeded after %d errors: %s", len(e.joined.errs), e.LastError)
+	}
 	return fmt.Sprintf("attempt count exceeded: %s", e.LastError)
 }
 
+// Unwrap returns the LastError, for use by errors.Is and errors.As. If the
+// JoinErrors of the CallArgs was set, it instead returns an error that
+// unwraps to every error returned, so that errors.Is and errors.As look at
+// all of them.
+func (e *AttemptsExceeded) Unwrap() error {
+	if e.joined != nil {
+		return e.joined
+	}
+	return e.LastError
+}
+
+// joinedErrors is a multi-error holding every error from the attempts, in
+// the same way as the result of errors.Join.
+type joinedErrors struct {
+	errs []error
+}
+
+// Error provides the implementation for the error interface method.
+func (e *joinedErrors) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns every error, for use by errors.Is and errors.As.
+func (e *joinedErrors) Unwrap() []error {
+	return e.errs
+}
+
 // IsAttemptsExceeded returns true if the error is a AttemptsExceeded
 // error.
 func IsAttemptsExceeded(err error) bool {
@@ -69,47 +149,529 @@ func IsAttemptsExceeded(err error) bool {
 	return ok
 }
 
-// IsRetryStopped returns true if the error is RetryStopped.
+// DurationExceeded is the error that is returned when the MaxDuration or
+// Deadline would be exceeded by waiting for the next attempt, without the
+// function having returned a nil error result. The last error returned from
+// the function being retried is available as the LastError attribute, and
+// every error returned, in attempt order, is available as the Errors
+// attribute. The total time spent retrying is available as the Elapsed
+// attribute, and the time that was left before the limit, which was less
+// than the next delay, as the Remaining attribute.
+type DurationExceeded struct {
+	LastError error
+	Errors    []error
+	Elapsed   time.Duration
+	Remaining time.Duration
+}
+
+// Error provides the implementation for the error interface method.
+func (e *DurationExceeded) Error() string {
+	return fmt.Sprintf("max duration exceeded: %s", e.LastError)
+}
+
+// Unwrap returns the LastError.
+func (e *DurationExceeded) Unwrap() error {
+	return e.LastError
+}
+
+// IsDurationExceeded returns true if the error is a DurationExceeded
+// error.
+func IsDurationExceeded(err error) bool {
+	_, ok := errors.Cause(err).(*DurationExceeded)
+	return ok
+}
+
+// RepeatedError is the error that is returned when the function being
+// retried has returned the same error MaxConsecutiveSameError times in a
+// row. The repeated error is available as the LastError attribute, and
+// every error returned, in attempt order, is available as the Errors
+// attribute. The total time spent retrying is available as the Elapsed
+// attribute.
+type RepeatedError struct {
+	LastError error
+	Errors    []error
+	Elapsed   time.Duration
+	Count     int
+}
+
+// Error provides the implementation for the error interface method.
+func (e *RepeatedError) Error() string {
+	return fmt.Sprintf("error repeated %d times: %s", e.Count, e.LastError)
+}
+
+// Unwrap returns the LastError.
+func (e *RepeatedError) Unwrap() error {
+	return e.LastError
+}
+
+// IsRepeatedError returns true if the error is caused by a RepeatedError.
+func IsRepeatedError(err error) bool {
+	_, ok := errors.Cause(err).(*RepeatedError)
+	return ok
+}
+
+// AttemptTimedOut is the error that is used as the result of an attempt
+// when the Func does not return within the AttemptTimeout.
+type AttemptTimedOut struct {
+	Timeout time.Duration
+}
+
+// Error provides the implementation for the error interface method.
+func (e *AttemptTimedOut) Error() string {
+	return fmt.Sprintf("attempt timed out after %v", e.Timeout)
+}
+
+// IsAttemptTimeout returns true if the error is an AttemptTimedOut error.
+func IsAttemptTimeout(err error) bool {
+	_, ok := errors.Cause(err).(*AttemptTimedOut)
+	return ok
+}
+
+// PanicError is the error that is used as the result of an attempt when
+// the Func panics and RecoverPanics is set. The value passed to panic is
+// available as the Value attribute, and the stack of the goroutine that
+// panicked as the Stack attribute.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error provides the implementation for the error interface method.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// IsPanicError returns true if the error is a PanicError.
+func IsPanicError(err error) bool {
+	_, ok := errors.Cause(err).(*PanicError)
+	return ok
+}
+
+// NotAttempted is the error that is returned when the retry loop is stopped
+// or cancelled before the function being retried has been called at all.
+// The error that stopped the loop is available as the Err attribute, and is
+// also the cause of the NotAttempted error, so IsRetryStopped and
+// IsRetryCancelled work as they would for a loop that has made attempts.
+type NotAttempted struct {
+	Err error
+}
+
+// Error provides the implementation for the error interface method.
+func (e *NotAttempted) Error() string {
+	return fmt.Sprintf("not attempted: %v", e.Err)
+}
+
+// Cause returns the cause of the error that stopped the retry loop.
+func (e *NotAttempted) Cause() error {
+	return errors.Cause(e.Err)
+}
+
+// Unwrap returns the error that stopped the retry loop, so that errors.Is
+// and errors.As can match it.
+func (e *NotAttempted) Unwrap() error {
+	return e.Err
+}
+
+// IsNotAttempted returns true if the error is, or was caused by, a
+// NotAttempted error.
+func IsNotAttempted(err error) bool {
+	for err != nil {
+		if _, ok := err.(*NotAttempted); ok {
+			return true
+		}
+		wrapper, ok := err.(interface{ Underlying() error })
+		if !ok {
+			return false
+		}
+		err = wrapper.Underlying()
+	}
+	return false
+}
+
+// IsRetryStopped returns true if the error is a RetryStopped error.
 func IsRetryStopped(err error) bool {
-	return errors.Cause(err) == RetryStopped
+	_, ok := errors.Cause(err).(*RetryStopped)
+	return ok
+}
+
+// IsRetryCancelled returns true if the error is the result of the Context
+// passed in the CallArgs being cancelled or its deadline expiring.
+func IsRetryCancelled(err error) bool {
+	cause := errors.Cause(err)
+	return cause == context.Canceled || cause == context.DeadlineExceeded
+}
+
+// Underlying returns the error from the function being retried for an
+// error that is, or was caused by, an AttemptsExceeded, DurationExceeded,
+// RepeatedError, BudgetExhausted or RetryStopped error, which is the
+// LastError attribute.
+// Any other error is returned unchanged, as is a RetryStopped error from a
+// loop that never called the function, so that a nil error is never
+// returned for a non-nil one. This lets callers that don't care about the
+// retries get at the real error, and errors.Cause can then be used on the
+// result as usual.
+func Underlying(err error) error {
+	var lastError error
+	switch cause := errors.Cause(err).(type) {
+	case *AttemptsExceeded:
+		lastError = cause.LastError
+	case *DurationExceeded:
+		lastError = cause.LastError
+	case *RepeatedError:
+		lastError = cause.LastError
+	case *BudgetExhausted:
+		lastError = cause.LastError
+	case *RetryStopped:
+		lastError = cause.LastError
+	}
+	if lastError == nil {
+		return err
+	}
+	return lastError
+}
+
+// Canceller is the interface that a Canceller in the CallArgs must
+// implement. It is satisfied by context.Context, and by other types that
+// have a done channel in the same way.
+type Canceller interface {
+	Done() <-chan struct{}
+	Err() error
+}
+
+// Sleeper is an optional interface that a Clock can implement to wait
+// between attempts without the allocation of a channel for every wait. Sleep
+// should wait for the duration, or until the context is done, in which case
+// it returns the context's error. Since a Stop channel cannot be passed to
+// Sleep, the Clock's After method is still used if the CallArgs have a Stop
+// channel or a Canceller.
+type Sleeper interface {
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// TimerClock is an optional interface that a Clock can implement so that
+// the wait between attempts uses a Timer, which is stopped if the wait is
+// interrupted by the Stop channel, Canceller or Context. With only After, the
+// timer behind the channel lives on until the delay is over, which adds up
+// for short lived retry loops that are often stopped. The wall clock is
+// treated as a TimerClock.
+type TimerClock interface {
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer made by a TimerClock. The channel returned by Chan
+// receives the time once the duration is over, unless Stop is called first.
+type Timer interface {
+	Chan() <-chan time.Time
+	Stop() bool
+}
+
+// wallTimer is a Timer for the wall clock.
+type wallTimer struct {
+	*time.Timer
+}
+
+// Chan returns the channel of the timer.
+func (t wallTimer) Chan() <-chan time.Time {
+	return t.C
+}
+
+// newTimer returns a Timer from the Clock, or nil if it is not a
+// TimerClock.
+func newTimer(c clock.Clock, d time.Duration) Timer {
+	if timerClock, ok := c.(TimerClock); ok {
+		return timerClock.NewTimer(d)
+	}
+	if c == clock.WallClock {
+		return wallTimer{time.NewTimer(d)}
+	}
+	return nil
 }
 
 // CallArgs is a simple structure used to define the behaviour of the Call
 // function.
+//
+// A WaitFunc takes the place of the delays, so it cannot be set with the
+// Delay, Schedule, BackoffFunc or MinInterval, and the jitter, DelayFunc and
+// RetryAfter have no effect. Its context is cancelled when the loop is
+// stopped, the MaxDuration and Deadline are only checked before it is
+// called, and if IncludeFinalDelay is set it is called after the final
+// attempt too.
 type CallArgs struct {
 	// Func is the function that will be retried if it returns an error result.
 	Func func() error
 
+	// FuncWithAttempt is an alternative to Func for functions that need to
+	// know which attempt they are on. The attempt number starts at 1 and
+	// matches the attempt passed to NotifyFunc. Exactly one of Func,
+	// FuncWithAttempt and FuncCtx must be set.
+	FuncWithAttempt func(attempt int) error
+
+	// FuncCtx is an alternative to Func for functions that can abort their
+	// work when a context is done. The context passed is derived from the
+	// Context, or is the background context if there is no Context. If the
+	// AttemptTimeout is set, the context also has a deadline of the
+	// AttemptTimeout, and is cancelled when the attempt times out, so that
+	// FuncCtx can give up rather than carrying on in the background. The
+	// context is also cancelled if the Stop channel is closed or the
+	// Canceller is done while the FuncCtx is running, unless that had
+	// already happened when the call started. The attempt number can be got
+	// from the context with AttemptFromContext.
+	FuncCtx func(ctx context.Context) error
+
 	// IsFatalError is a function that, if set, will be called for every non-
 	// nil error result from `Func`. If `IsFatalError` returns true, the error
-	// is immediately returned breaking out from any further retries.
+	// is immediately returned breaking out from any further retries. If
+	// neither IsFatalError nor IsFatalErrorWithAttempt is set, an error that
+	// is, or wraps, context.Canceled or context.DeadlineExceeded is fatal if
+	// the Context is done by the time Func returns, as it means that Func
+	// was cancelled rather than failing. The same errors are retried while
+	// the Context is not done, as they may come from a timeout within Func
+	// or from the AttemptTimeout.
 	IsFatalError func(error) bool
 
+	// IsFatalErrorWithAttempt is an alternative to `IsFatalError` that is
+	// also passed the attempt number, so an error can be treated as fatal
+	// only once it has persisted for a number of attempts. If set, it is used
+	// instead of `IsFatalError`.
+	IsFatalErrorWithAttempt func(err error, attempt int) bool
+
+	// IsRetryableError is a function that, if set, will be called for every
+	// non-nil error result from `Func`. Only if `IsRetryableError` returns
+	// true is the error retried, otherwise it is immediately returned. It is
+	// the inverse of `IsFatalError`, and the two cannot both be set.
+	IsRetryableError func(error) bool
+
+	// StartAttempt, if set, is called just before each call to Func with the
+	// attempt number. The function that it returns, if not nil, is called
+	// once the Func returns, with the error it returned. This allows each
+	// attempt to be traced, for instance as a child span, without the retry
+	// package depending on a tracing library. The end function is called
+	// even if Func panics, in which case it is passed an error describing
+	// the panic, and the panic then carries on, unless RecoverPanics is set.
+	// If the attempt times out due to the AttemptTimeout, end is called when
+	// the Func does return.
+	StartAttempt func(attempt int) (end func(err error))
+
 	// NotifyFunc is a function that is called if Func fails, and the attempt
 	// number. The first time this function is called attempt is 1, the second
 	// time, attempt is 2 and so on.
 	NotifyFunc func(lastError error, attempt int)
 
+	// FatalFunc is a function that is called once if `IsFatalError` or
+	// `IsFatalErrorWithAttempt` says that the error from Func is fatal,
+	// with the error and the attempt number, just before Call returns. It is
+	// not called when the loop stops for any other reason, such as running
+	// out of attempts, the Stop channel, or the error not being retryable.
+	FatalFunc func(err error, attempt int)
+
+	// NotifyFuncV2 is like NotifyFunc, but is also told whether there is going
+	// to be another attempt, and whether the error is the same as the one
+	// from the previous attempt according to the SameError. It is called as
+	// well as NotifyFunc if both are set.
+	NotifyFuncV2 func(err error, attempt int, willRetry, sameAsPrevious bool)
+
+	// NotifyFuncWithState is like NotifyFuncV2, and is called at the same
+	// times, but is passed a State describing the loop, such as the
+	// current delay and the time elapsed, which is a snapshot rather than
+	// a live view of the loop. It is called as well as NotifyFunc and
+	// NotifyFuncV2 if they are set.
+	NotifyFuncWithState func(state State)
+
+	// ShouldRetry is a function that, if set, is called after each failed
+	// attempt that would otherwise be retried, with the error and the attempt
+	// number. It is called after `IsFatalError` and `IsRetryableError` have
+	// classified the error as retryable, and after `NotifyFunc`. If
+	// ShouldRetry returns false, the loop stops and the error is returned
+	// wrapped in a `RetryStopped` error. It is not called after the final
+	// attempt.
+	ShouldRetry func(err error, attempt int) bool
+
+	// NotifyFuncWithDelay is like NotifyFunc, but is also passed the delay
+	// before the next attempt. The delay is the value actually used for the
+	// wait, after any scaling, clamping and jitter. If there is not going to
+	// be another attempt, the delay is zero. It is called for each failure
+	// that `IsFatalError` and `IsRetryableError` allow to be retried, after
+	// `ShouldRetry` has been consulted.
+	NotifyFuncWithDelay func(lastError error, attempt int, nextDelay time.Duration)
+
+	// SuccessFunc is a function that is called once when Func succeeds, with
+	// the attempt number and the total time spent in Call, as measured by the
+	// Clock. It is not called if Call returns an error.
+	SuccessFunc func(attempt int, total time.Duration)
+
+	// ErrorFormatter, if set, is used to make the message of the
+	// `AttemptsExceeded` error from the last error and the number of
+	// attempts made. The error is still an `AttemptsExceeded`, so
+	// `IsAttemptsExceeded` is true for its cause. If ErrorFormatter is not
+	// set, the message is "attempt count exceeded: " and the last error.
+	ErrorFormatter func(lastError error, attempts int) string
+
+	// JoinErrors, if true, makes the `AttemptsExceeded` error unwrap to
+	// every error returned from Func, rather than just the last one, in the
+	// same way as an error from errors.Join. This lets errors.Is and
+	// errors.As find an error from any attempt. The message then says how
+	// many errors there were, as well as giving the last error.
+	JoinErrors bool
+
+	// MaxConsecutiveSameError, if set, stops the loop when Func returns the
+	// same error this many times in a row, as retrying is unlikely to help.
+	// The error is returned wrapped in a `RepeatedError`. Only errors that
+	// IsFatalError and IsRetryableError allow to be retried are counted.
+	MaxConsecutiveSameError int
+
+	// SameError, if set, is used to decide whether an error is the same as
+	// the previous one, for MaxConsecutiveSameError and the sameAsPrevious
+	// passed to NotifyFuncV2. It can compare errors by type, by a status
+	// code, or however suits the Func. By default an error is the same if it
+	// matches the cause of the previous error according to errors.Is, or if
+	// it has the same message, as many errors are created afresh each time.
+	SameError func(err, previous error) bool
+
+	// IncludeFinalDelay, if true, makes Call wait for the delay after the
+	// final attempt fails, before returning the `AttemptsExceeded` error, so
+	// that a caller that retries the whole Call in its own loop is paced by
+	// the same delays. The final delay is not waited for if it would pass
+	// the MaxDuration or Deadline. If the wait is interrupted by the Stop,
+	// Canceller or Context, the `AttemptsExceeded` error is still returned.
+	// By default there is no wait after the final attempt.
+	IncludeFinalDelay bool
+
 	// Attempts specifies the number of times Func should be retried before
-	// giving up and returning the `AttemptsExceeded` error. If a negative
-	// value is specified, the `Call` will retry forever.
+	// giving up and returning the `AttemptsExceeded` error. If
+	// `UnlimitedAttempts` is specified, the `Call` will retry forever. Other
+	// negative values are not valid. If Attempts is 1, there is no retry to
+	// exceed, so if Func fails its error is returned as it is, rather than
+	// being wrapped in an `AttemptsExceeded` error.
 	Attempts int
 
-	// Delay specifies how long to wait between retries.
+	// Delay specifies how long to wait between retries. Either Delay or
+	// Schedule must be set. If the delay before an attempt works out to be
+	// zero, for instance because of a BackoffFunc or DelayFunc, the next
+	// attempt is made straight away after yielding to other goroutines. With
+	// UnlimitedAttempts this is a tight loop, so the MinDelay should be set if
+	// the delay can be zero.
 	Delay time.Duration
 
+	// Schedule, if set, gives the delay to wait after each failed attempt in
+	// turn, rather than computing the delays from the Delay. If there are
+	// more attempts than delays in the Schedule, the last delay is used for
+	// the rest of them. If Attempts is not set, it defaults to one more than
+	// the number of delays, so each delay is used once. The delays are still
+	// limited by the MinDelay and MaxDelay, and can have jitter applied.
+	// Schedule cannot be used with the Delay, BackoffFactor, BackoffFunc or
+	// BackoffForError.
+	Schedule []time.Duration
+
+	// InitialDelay specifies how long to wait before the first attempt. It is
+	// separate from the Delay, and is not affected by the BackoffFactor. The
+	// wait can be interrupted by the Stop channel or the Context, in which
+	// case Func is not attempted at all and a `NotAttempted` error is
+	// returned. If no value is specified the first attempt is made
+	// immediately.
+	InitialDelay time.Duration
+
+	// SpreadFirstAttempt, if set, delays the first attempt by a random
+	// duration between zero and SpreadFirstAttempt, so that many processes
+	// that start at the same time don't all make their first attempt at
+	// once. It is added to the InitialDelay, and the wait can be interrupted
+	// in the same way.
+	SpreadFirstAttempt time.Duration
+
 	// MaxDelay specifies how longest time to wait between retries. If no
-	// value is specified there is no maximum delay.
+	// value is specified there is no maximum delay. If it is less than the
+	// Delay, which is most likely a mistake, the first delay is still the
+	// Delay and the later ones are the MaxDelay, and Call logs a warning to
+	// the Logger.
 	MaxDelay time.Duration
 
+	// MaxDelayedAttempts, if set, limits how many retries are delayed. Once
+	// that many retries have waited for a delay, later retries are made
+	// straight away, after yielding to other goroutines, which is useful
+	// for draining a queue quickly once it has had time to recover. The
+	// Stop, Canceller and Context are still checked before each retry. As
+	// no more time is spent waiting, a MaxDuration or Deadline only ends the
+	// loop once the time spent in Func has used it up.
+	MaxDelayedAttempts int
+
+	// MinInterval, if set, is the shortest time from the start of one
+	// attempt to the start of the next, as measured by the Clock, such as
+	// for an API that limits the rate of requests. If the delay before the
+	// next attempt would start it sooner, the delay is made longer, even
+	// past the MaxDelay, and if Func took longer than the MinInterval, the
+	// delay is used as it is. With a MinInterval the Delay is optional, in
+	// which case the next attempt starts straight away once the MinInterval
+	// has passed.
+	MinInterval time.Duration
+
+	// MinDelay specifies the shortest time to wait between retries. The
+	// delay is raised to at least MinDelay after it has been scaled and had
+	// any jitter applied. If no value is specified there is no minimum delay.
+	MinDelay time.Duration
+
+	// MaxDuration specifies the longest time that Call will spend retrying,
+	// measured with the Clock from when Call starts. If waiting for the next
+	// attempt would take the total time past MaxDuration, the wait is not
+	// started and the `DurationExceeded` error is returned. If no value is
+	// specified there is no limit to the time spent. MaxDuration can be used
+	// along with Attempts, in which case the loop stops when either limit is
+	// reached. If the final attempt fails, `AttemptsExceeded` is returned
+	// even if the MaxDuration has also passed, as there is no wait to skip.
+	MaxDuration time.Duration
+
+	// Deadline, if set, is a time after which Call will not retry, compared
+	// with the time from the Clock. It behaves in the same way as the
+	// MaxDuration, but is an absolute time, such as when a lease expires,
+	// rather than being relative to when Call starts. Deadline and
+	// MaxDuration cannot both be set.
+	Deadline time.Time
+
+	// MaxDelayFraction, if set, limits each wait to this fraction of the time
+	// left before the MaxDuration is reached, so that there is time for more
+	// attempts as the MaxDuration gets closer. It must be between zero and
+	// one, and can only be used with a MaxDuration or Deadline, in which
+	// case it is the time left before the Deadline. If the MaxDelay is also
+	// set, the wait is limited by whichever is shorter. The limit is applied
+	// to the wait itself, after the jitter, so the wait may be less than the
+	// MinDelay, and the delay that the backoff grows from is not affected.
+	MaxDelayFraction float64
+
 	// BackoffFactor is a multiplier used on the Delay each time the function waits.
 	// If not specified, a factor of 1 is used, which means the delay does not increase
 	// each time through the loop. A factor of 2 would indicate that the second delay
 	// would be twice the first, and the third twice the second, and so on.
+	// A factor of less than one is only valid if AllowDecay is set.
 	BackoffFactor float64
 
+	// BackoffFactorJitter, if set, randomizes the BackoffFactor (or the
+	// factor from BackoffForError) each time it is used, by up to this
+	// fraction either way, so the factor used is drawn uniformly from
+	// `factor * (1 - BackoffFactorJitter)` to
+	// `factor * (1 + BackoffFactorJitter)`. Unlike jitter on the delay, the
+	// randomness compounds along the backoff chain. It must be at least zero
+	// and less than one. It is not applied to a BackoffFunc or Schedule.
+	BackoffFactorJitter float64
+
+	// AllowDecay, if true, allows a BackoffFactor between zero and one, so
+	// that each delay is shorter than the last. This suits polling that
+	// should start slowly and get more eager. Since a decaying delay tends
+	// towards zero, the MinDelay must also be set, and the delay settles at
+	// the MinDelay once it has decayed that far.
+	AllowDecay bool
+
+	// BackoffForError, if set, is called with the error after each failed
+	// attempt that is to be retried, and returns the factor to use instead of
+	// the BackoffFactor for the next delay only. This allows the backoff to
+	// be gentle for some errors and aggressive for others. If it returns
+	// zero, or a negative value, the BackoffFactor is used. The delay is
+	// still limited by the MinDelay and MaxDelay. It cannot be used with a
+	// BackoffFunc.
+	BackoffForError func(err error) float64
+
 	// Clock defaults to clock.Wall, but allows the caller to pass one in.
-	// Primarily used for testing purposes.
+	// Primarily used for testing purposes. If the After of the Clock returns
+	// a nil channel, which would never receive, Call returns a NotValid
+	// error rather than waiting forever. The Clock can also implement
+	// Sleeper or TimerClock to change how the waits are done.
 	Clock clock.Clock
 
 	// Stop is a channel that can be used to indicate that the waiting should
@@ -117,11 +679,172 @@ type CallArgs struct {
 	// If the channel is closed prior to the Call function being executed, the
 	// Func is still attempted once.
 	Stop <-chan struct{}
+
+	// Canceller, if set, stops the loop in the same way as the Stop channel
+	// when its Done channel is closed. It allows code that has a
+	// context.Context, or something like one, to be used where a Stop
+	// channel was used before. If both Stop and Canceller are set, either of
+	// them stops the loop. Unlike the Context, a Canceller that is already
+	// done does not prevent the first attempt, and the error returned is a
+	// `RetryStopped` error.
+	Canceller Canceller
+
+	// Context, if set, is checked before every attempt, including the first,
+	// and while waiting between attempts. Once the context is done, Call
+	// returns an error whose cause is the context's error. Unlike Stop, a
+	// Context that is already done means Func is not attempted at all, and
+	// the error returned is a `NotAttempted` error.
+	// If both Stop and Context are set, whichever fires first while waiting
+	// stops the loop. If none of Stop, Canceller and Context are set, the
+	// DefaultContext is used.
+	Context context.Context
+
+	// Pauser, if set, can pause the retry loop. While the Pauser is paused,
+	// a loop whose attempt has failed waits for it to be resumed before
+	// working out the delay to the next attempt, so the backoff carries on
+	// from where it was. The Stop, Canceller and Context still interrupt the
+	// loop while it is paused. The time spent paused is measured by the
+	// Clock like any other, so it counts towards the MaxDuration, and the
+	// loop stops once resumed if the MaxDuration has passed. The Pauser does
+	// not hold up the first attempt, or the end of the final one.
+	Pauser *Pauser
+
+	// DeadlineMargin, if set, makes the most of a Context with a deadline.
+	// If the wait before the next attempt would end less than DeadlineMargin
+	// before the deadline, the wait is shortened so that it ends
+	// DeadlineMargin before the deadline, leaving time for one last attempt
+	// rather than waiting past the deadline. The shortened wait may be less
+	// than the MinDelay. If there is less than DeadlineMargin left, the wait
+	// is not changed. The time left is measured with the Clock.
+	DeadlineMargin time.Duration
+
+	// FinalAttemptOnStop, if true, makes one last best effort call to Func
+	// when the Stop channel is closed or the Context is done while waiting
+	// between attempts. The result of that call is returned instead of the
+	// stop error. Note that this can delay shutdown for as long as Func
+	// takes to return, or for the AttemptTimeout if that is set.
+	FinalAttemptOnStop bool
+
+	// Budget, if set, limits the rate of retries across all the calls that
+	// share the Budget. If the Budget has no retries left when Func fails, the
+	// `BudgetExhausted` error is returned rather than retrying.
+	Budget *Budget
+
+	// Jitter, if true, randomizes each delay to a value between half the
+	// computed delay and the computed delay itself. The jitter is applied
+	// after the delay has been scaled by the BackoffFactor and capped by the
+	// MaxDelay, so the delay never exceeds MaxDelay.
+	Jitter bool
+
+	// JitterFactor, if set, randomizes each delay by reducing it by up to this
+	// fraction of the computed delay, so the delay used is
+	// `delay * (1 - JitterFactor*rand)`. It must be between zero and one, and
+	// like Jitter, it is applied after the BackoffFactor and MaxDelay. Jitter
+	// is the same as a JitterFactor of 0.5, and the two cannot both be set.
+	JitterFactor float64
+
+	// Rand, if set, is the source of randomness for the Jitter, JitterFactor,
+	// BackoffFactorJitter and SpreadFirstAttempt, so that the same seed gives
+	// the same delays every time, for instance in a simulation or a test of
+	// a backoff policy. As a *rand.Rand is not safe for concurrent use, it
+	// must not be shared by calls that run at the same time. If it is not
+	// set, the global source from math/rand is used, which is seeded
+	// randomly. The BackoffFuncs from FullJitterBackoff, DecorrelatedJitter
+	// and RandomDelay are not given the CallArgs, so they use the global
+	// source; pass the Rand to FullJitterBackoffWithRand,
+	// DecorrelatedJitterWithRand or RandomDelayWithRand instead.
+	Rand *rand.Rand
+
+	// BackoffFunc, if set, is used to calculate the delay before each retry,
+	// overriding the BackoffFactor. It is called with the previous delay,
+	// which is Delay the first time, and the attempt number that just failed.
+	// If the backoff is reset due to ResetAfter, the attempt number starts
+	// again from 1. The result is still capped by the MaxDelay. BackoffFunc
+	// cannot be used with a BackoffFactor other than one.
+	BackoffFunc BackoffFunc
+
+	// DelayFunc, if set, is called after each failed attempt that is to be
+	// retried, with the error, the attempt number and the delay that would
+	// otherwise be used. The delay it returns is used for the next wait only,
+	// and is still constrained by MinDelay and MaxDelay. The Delay continues
+	// to grow by the BackoffFactor or BackoffFunc for later attempts. This
+	// allows a hint in the error, such as an HTTP Retry-After header, to be
+	// honoured while falling back to the normal backoff when there is none.
+	// It is not called for an error returned from `RetryAfter`.
+	DelayFunc func(err error, attempt int, defaultDelay time.Duration) time.Duration
+
+	// ResetAfter, if set, resets the backoff when a single call to Func takes
+	// at least this long, as measured by the Clock. This is useful for
+	// long running functions, such as streaming connections, where a call
+	// that ran for a while before failing should be retried quickly. After a
+	// reset the next delay is Delay again, and the BackoffFactor or
+	// BackoffFunc grows the delay from there as if it were the first retry.
+	ResetAfter time.Duration
+
+	// AttemptTimeout, if set, limits how long each call to Func may take, as
+	// measured by the Clock. If Func has not returned within the timeout, the
+	// attempt fails with an `AttemptTimedOut` error, which is then handled
+	// like any other error from Func. To allow this, Func is called in its
+	// own goroutine. Since Func cannot be interrupted, a Func that never
+	// returns will leak its goroutine.
+	AttemptTimeout time.Duration
+
+	// RecoverPanics, if true, recovers a panic in Func, and treats it as the
+	// Func returning a `PanicError`. The error is handled like any other
+	// error from Func, so it is retried unless IsFatalError or
+	// IsRetryableError say otherwise. By default a panic is not recovered.
+	RecoverPanics bool
+
+	// HedgeAfter, if set, makes each attempt hedge its bets for a FuncCtx
+	// that is slow to return. If the FuncCtx has not returned within the
+	// HedgeAfter, as measured by the Clock, it is called again alongside the
+	// first call, and whichever call succeeds first is used. The context
+	// passed to the other calls is then cancelled. Only if every call fails
+	// does the attempt fail, with the error from the last call to return,
+	// which is then handled as normal. HedgeAfter can only be used with
+	// FuncCtx, as the calls that lose must be able to give up.
+	HedgeAfter time.Duration
+
+	// MaxHedges is the number of extra calls that may be started for each
+	// attempt when the HedgeAfter is set, each one after the HedgeAfter has
+	// passed again. If no value is specified, one extra call is made.
+	MaxHedges int
+
+	// WaitFunc, if set, is called instead of waiting for a delay between
+	// attempts, such as to wait for a token from a rate limiter shared with
+	// other code. If it returns an error, the loop stops with that error,
+	// annotated to say it came from the WaitFunc.
+	WaitFunc func(ctx context.Context) error
+
+	// Executor, if set, is where each call to the Func is run, such as a
+	// pool of worker goroutines shared with other calls, so that the number
+	// of Funcs running at once can be bounded in one place. Call waits for
+	// the Func to return, as it would without an Executor, and a panic in
+	// the Func carries on from Call, unless RecoverPanics is set. See the
+	// Executor interface for what happens once the Executor is shut down.
+	Executor Executor
+
+	// Logger, if set, is a *slog.Logger that each failed attempt that is to
+	// be retried is logged to at the Warn level, with the attempt, error and
+	// next_delay attributes. The outcome of the retry loop is logged at the
+	// Info level on success, or the Error level on failure. The Logger is
+	// only available when built with Go 1.21 or later.
+	Logger slogLogger
+
+	// Metrics, if set, is told about each attempt, each wait between
+	// attempts and the outcome of the retry loop.
+	Metrics Metrics
+
+	// stats, if set, records the time spent sleeping and calling Func.
+	stats *Stats
 }
 
-// Validate the values are valid. The ensures that the Func, Delay and Attempts
-// have been specified, and that the BackoffFactor makes sense (i.e. one or greater).
-// If BackoffFactor is not explicitly set, it is set here to be one.
+// Validate the values are valid. The ensures that exactly one of Func,
+// FuncWithAttempt or FuncCtx, the Delay or Schedule and Attempts have been
+// specified, and that the BackoffFactor makes sense (i.e. one or greater,
+// or between zero and one if AllowDecay is set).
+// If BackoffFactor is not explicitly set, it is set here to be one, and if
+// a Schedule is set without Attempts, Attempts is set to match it.
 func (args *CallArgs) Validate() error {
 	if args.BackoffFactor == 0 {
 		args.BackoffFactor = 1
@@ -129,67 +852,927 @@ func (args *CallArgs) Validate() error {
 	if args.Clock == nil {
 		args.Clock = clock.WallClock
 	}
-	if args.Func == nil {
-		return errors.NotValidf("missing Func")
+	if err := args.validateFunc(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := args.validateHedge(); err != nil {
+		return errors.Trace(err)
 	}
-	if args.Delay == 0 {
+	if err := args.validateWaitFunc(); err != nil {
+		return errors.Trace(err)
+	}
+	if len(args.Schedule) > 0 {
+		if err := args.validateSchedule(); err != nil {
+			return errors.Trace(err)
+		}
+		if args.Attempts == 0 {
+			args.Attempts = len(args.Schedule) + 1
+		}
+	} else if args.Delay == 0 && args.MinInterval == 0 && args.WaitFunc == nil {
 		return errors.NotValidf("missing Delay")
 	}
+	if args.MinInterval < 0 {
+		return errors.NotValidf("MinInterval of %v", args.MinInterval)
+	}
 	if args.Attempts == 0 {
 		return errors.NotValidf("missing Attempts")
 	}
-	if args.BackoffFactor < 1 {
+	if args.Delay < 0 {
+		return errors.NotValidf("Delay of %v", args.Delay)
+	}
+	if args.SpreadFirstAttempt < 0 {
+		return errors.NotValidf("SpreadFirstAttempt of %v", args.SpreadFirstAttempt)
+	}
+	if args.Attempts < UnlimitedAttempts {
+		return errors.NotValidf("Attempts of %d", args.Attempts)
+	}
+	if args.BackoffFactor < 1 && !(args.AllowDecay && args.BackoffFactor > 0) {
 		return errors.NotValidf("BackoffFactor of %s", args.BackoffFactor)
 	}
+	if args.BackoffFactor < 1 && args.MinDelay <= 0 {
+		return errors.NotValidf("BackoffFactor of %v without MinDelay", args.BackoffFactor)
+	}
+	if (args.IsFatalError != nil || args.IsFatalErrorWithAttempt != nil) && args.IsRetryableError != nil {
+		return errors.NotValidf("setting both IsFatalError and IsRetryableError")
+	}
+	if args.MaxDelayedAttempts < 0 {
+		return errors.NotValidf("MaxDelayedAttempts of %d", args.MaxDelayedAttempts)
+	}
+	if args.MaxConsecutiveSameError < 0 {
+		return errors.NotValidf("MaxConsecutiveSameError of %d", args.MaxConsecutiveSameError)
+	}
+	if args.MaxDelayFraction < 0 || args.MaxDelayFraction > 1 {
+		return errors.NotValidf("MaxDelayFraction of %v", args.MaxDelayFraction)
+	}
+	if args.MaxDuration > 0 && !args.Deadline.IsZero() {
+		return errors.NotValidf("setting both MaxDuration and Deadline")
+	}
+	if args.MaxDelayFraction > 0 && args.MaxDuration <= 0 && args.Deadline.IsZero() {
+		return errors.NotValidf("MaxDelayFraction without MaxDuration or Deadline")
+	}
+	if args.BackoffFactorJitter < 0 || args.BackoffFactorJitter >= 1 {
+		return errors.NotValidf("BackoffFactorJitter of %v", args.BackoffFactorJitter)
+	}
+	if args.JitterFactor < 0 || args.JitterFactor > 1 {
+		return errors.NotValidf("JitterFactor of %v", args.JitterFactor)
+	}
+	if args.Jitter && args.JitterFactor != 0 {
+		return errors.NotValidf("setting both Jitter and JitterFactor")
+	}
+	if args.MinDelay > args.MaxDelay && args.MaxDelay > 0 {
+		return errors.NotValidf("MinDelay of %v greater than MaxDelay of %v", args.MinDelay, args.MaxDelay)
+	}
+	if args.BackoffFunc != nil && args.BackoffFactor != 1 {
+		return errors.NotValidf("BackoffFactor of %v with BackoffFunc", args.BackoffFactor)
+	}
+	if args.BackoffFunc != nil && args.BackoffForError != nil {
+		return errors.NotValidf("setting both BackoffFunc and BackoffForError")
+	}
+	return nil
+}
+
+// validateSchedule checks that the Schedule is not used with the fields
+// that it replaces.
+func (args *CallArgs) validateSchedule() error {
+	if args.Delay != 0 {
+		return errors.NotValidf("setting both Schedule and Delay")
+	}
+	if args.BackoffFactor != 1 {
+		return errors.NotValidf("setting both Schedule and BackoffFactor")
+	}
+	if args.BackoffFunc != nil {
+		return errors.NotValidf("setting both Schedule and BackoffFunc")
+	}
+	if args.BackoffForError != nil {
+		return errors.NotValidf("setting both Schedule and BackoffForError")
+	}
+	for _, delay := range args.Schedule {
+		if delay < 0 {
+			return errors.NotValidf("Schedule delay of %v", delay)
+		}
+	}
 	return nil
 }
 
+// Clone returns a copy of the CallArgs that can be modified without
+// affecting the original. Functions, channels, the Clock and the Context are
+// references, so they are shared with the original. The Schedule is copied.
+func (args *CallArgs) Clone() CallArgs {
+	clone := *args
+	if args.Schedule != nil {
+		clone.Schedule = append([]time.Duration(nil), args.Schedule...)
+	}
+	return clone
+}
+
+// DelaySchedule returns the delays that would be waited between attempts if
+// every attempt failed, applying the Schedule, BackoffFactor or BackoffFunc,
+// MaxDelay and MinDelay. There is one fewer delay than Attempts, which
+// defaults to one more than the length of the Schedule if that is set.
+// Jitter, the BackoffFactorJitter, the DelayFunc and the BackoffForError are
+// not applied, as they do not give a predictable delay, so the delays waited
+// by Call can be shorter or, with a BackoffFactorJitter, longer. The
+// InitialDelay, MaxDuration and ResetAfter are ignored. If Attempts is
+// UnlimitedAttempts or otherwise not positive, nil is returned. The defaults
+// given to SetDefaults are applied as they would be by Call.
+func (args *CallArgs) DelaySchedule() []time.Duration {
+	withDefaults := *args
+	withDefaults.applyDefaults()
+	args = &withDefaults
+	attempts := args.Attempts
+	if attempts == 0 && len(args.Schedule) > 0 {
+		attempts = len(args.Schedule) + 1
+	}
+	if attempts <= 0 {
+		return nil
+	}
+	factor := args.BackoffFactor
+	if factor == 0 {
+		factor = 1
+	}
+	schedule := make([]time.Duration, 0, attempts-1)
+	delay := args.Delay
+	for step := 1; step < attempts; step++ {
+		delay = args.backoff(delay, step, factor)
+		schedule = append(schedule, delay)
+	}
+	return schedule
+}
+
 // Call will repeatedly execute the Func until either the function returns no
-// error, the retry count is exceeded or the stop channel is closed.
+// error, the retry count is exceeded, the stop channel is closed or the
+// context is done.
+// Any of the Delay, Attempts, BackoffFactor, MaxDelay and Clock that are not
+// set are taken from the defaults given to SetDefaults.
 func Call(args CallArgs) error {
+	_, err := CallCount(args)
+	return err
+}
+
+// CallCount behaves the same as Call, and also returns the number of times
+// the Func was called. If the Func succeeds the first time, the count is one.
+func CallCount(args CallArgs) (int, error) {
+	attempts, err := args.run()
+	return attempts, args.single(err)
+}
+
+// run runs the retry loop and reports its outcome. Unlike CallCount, it
+// returns the AttemptsExceeded error even if Attempts is 1, so that the
+// callers in this package can still tell why the loop gave up.
+func (args *CallArgs) run() (int, error) {
+	attempts, err := args.callCount()
+	args.logOutcome(attempts, args.single(err))
+	args.metricsOutcome(attempts, err)
+	return attempts, err
+}
+
+// single returns the error from Func in place of the AttemptsExceeded
+// error if Attempts is 1, as there was no retry to exceed.
+func (args *CallArgs) single(err error) error {
+	if args.Attempts != 1 {
+		return err
+	}
+	if exceeded, ok := errors.Cause(err).(*AttemptsExceeded); ok {
+		return errors.Trace(exceeded.LastError)
+	}
+	return err
+}
+
+func (args *CallArgs) callCount() (int, error) {
+	args.applyDefaults()
 	err := args.Validate()
 	if err != nil {
-		return errors.Trace(err)
+		return 0, errors.Trace(err)
 	}
+	if args.Stop == nil && args.Canceller == nil && args.Context == nil {
+		args.Context = DefaultContext
+	}
+	if args.MaxDelay > 0 && args.MaxDelay < args.Delay {
+		args.logMaxDelay()
+	}
+	start := args.Clock.Now()
+	initialDelay := args.InitialDelay
+	if args.SpreadFirstAttempt > 0 {
+		initialDelay += time.Duration(args.random() * float64(args.SpreadFirstAttempt))
+	}
+	if initialDelay > 0 {
+		switch args.sleep(initialDelay) {
+		case sleepStopped:
+			return 0, &NotAttempted{&RetryStopped{Elapsed: args.Clock.Now().Sub(start)}}
+		case sleepCancelled:
+			return 0, &NotAttempted{args.Context.Err()}
+		case sleepBrokenClock:
+			return 0, brokenClock()
+		}
+	}
+	var errs []error
+	delay := args.Delay
+	// step counts the failures since the backoff was last reset.
+	step := 0
+	attempts := 0
+	// repeats counts how many times in a row the same error has occurred.
+	repeats := 0
+	// delayed counts the retries that have waited for a delay.
+	delayed := 0
+	// retrying is true once a slot has been taken from SetMaxConcurrent.
+	retrying := false
+	// state is what the notify functions are told about the loop.
+	var state State
 	for i := 1; args.Attempts < 0 || i <= args.Attempts; i++ {
-		err = args.Func()
+		if args.Context != nil && args.Context.Err() != nil {
+			if attempts == 0 {
+				return 0, &NotAttempted{args.Context.Err()}
+			}
+			return attempts, errors.Trace(args.Context.Err())
+		}
+		attempts = i
+		attemptStart := args.Clock.Now()
+		err = args.call(i)
 		if err == nil {
-			return nil
+			if args.SuccessFunc != nil {
+				args.SuccessFunc(i, args.Clock.Now().Sub(start))
+			}
+			return attempts, nil
 		}
-		if args.IsFatalError != nil && args.IsFatalError(err) {
-			return errors.Trace(err)
+		step++
+		if args.ResetAfter > 0 && args.Clock.Now().Sub(attemptStart) >= args.ResetAfter {
+			delay = args.Delay
+			step = 1
+		}
+		errs = append(errs, err)
+		// same is true if the error is the same as the previous one.
+		same := len(errs) > 1 && args.sameError(err, errs[len(errs)-2])
+		state = State{
+			Attempt:        i,
+			Err:            err,
+			Delay:          delay,
+			Elapsed:        args.Clock.Now().Sub(start),
+			SameAsPrevious: same,
+		}
+		if cause, ok := aborted(err); ok {
+			args.notifyV2(state, false)
+			return attempts, errors.Trace(cause)
+		}
+		if args.isFatal(err, i) {
+			args.notifyV2(state, false)
+			// FatalFunc is only for errors that the caller has said are
+			// fatal, not for a Context that is done.
+			if args.FatalFunc != nil && (args.IsFatalError != nil || args.IsFatalErrorWithAttempt != nil) {
+				args.FatalFunc(err, i)
+			}
+			return attempts, errors.Trace(err)
+		}
+		if args.IsRetryableError != nil && !args.IsRetryableError(err) {
+			args.notifyV2(state, false)
+			return attempts, errors.Trace(err)
 		}
 		if args.NotifyFunc != nil {
 			args.NotifyFunc(err, i)
 		}
-		if i == args.Attempts && args.Attempts > 0 {
+		if args.MaxConsecutiveSameError > 0 {
+			if same {
+				repeats++
+			} else {
+				repeats = 1
+			}
+			if repeats >= args.MaxConsecutiveSameError {
+				args.notifyDelay(state, 0, false)
+				return attempts, errors.Wrap(err, &RepeatedError{
+					LastError: err,
+					Errors:    copyErrors(errs),
+					Elapsed:   args.Clock.Now().Sub(start),
+					Count:     repeats,
+				})
+			}
+		}
+		final := i == args.Attempts && args.Attempts > 0
+		if final && !args.IncludeFinalDelay {
+			args.notifyDelay(state, 0, false)
 			break // don't wait before returning the error
 		}
-		// Wait for the delay, and retry
+		if !final && args.ShouldRetry != nil && !args.ShouldRetry(err, i) {
+			args.notifyDelay(state, 0, false)
+			return attempts, errors.Wrap(err, &RetryStopped{
+				LastError: err,
+				Errors:    copyErrors(errs),
+				Elapsed:   args.Clock.Now().Sub(start),
+			})
+		}
+		if !final && args.Budget != nil && !args.Budget.take(args.Clock.Now()) {
+			args.notifyDelay(state, 0, false)
+			return attempts, errors.Wrap(err, &BudgetExhausted{
+				LastError: err,
+				Errors:    copyErrors(errs),
+				Elapsed:   args.Clock.Now().Sub(start),
+			})
+		}
+		if !final && args.Pauser != nil {
+			if result := args.Pauser.wait(args); result != sleepCompleted {
+				args.notifyDelay(state, 0, false)
+				return args.interrupted(result, i, start, err, errs)
+			}
+		}
+		if !final && !retrying {
+			// The slot is taken before the delay is worked out, so that
+			// the time spent queueing for it counts towards the
+			// MaxDuration or Deadline.
+			if result := args.acquireSlot(); result != sleepCompleted {
+				args.notifyDelay(state, 0, false)
+				return args.interrupted(result, i, start, err, errs)
+			}
+			retrying = true
+			defer releaseSlot()
+		}
+		factor := args.BackoffFactor
+		if args.BackoffForError != nil {
+			if f := args.BackoffForError(err); f > 0 {
+				factor = f
+			}
+		}
+		if args.BackoffFactorJitter > 0 {
+			factor *= 1 + args.BackoffFactorJitter*(2*args.random()-1)
+		}
+		delay = args.backoff(delay, step, factor)
+		state.Delay = delay
+		wait := delay
+		if after, ok := retryAfterDelay(err); ok {
+			wait = ClampDuration(after, 0, args.MaxDelay)
+		} else {
+			if factor := args.jitterFactor(); factor > 0 {
+				wait = ClampDuration(args.jitter(wait, factor), args.MinDelay, args.MaxDelay)
+			}
+			if args.DelayFunc != nil {
+				wait = ClampDuration(args.DelayFunc(err, i, wait), args.MinDelay, args.MaxDelay)
+			}
+		}
+		remaining, limited := args.remaining(start)
+		if limited && args.MaxDelayFraction > 0 {
+			if limit := time.Duration(args.MaxDelayFraction * float64(remaining)); wait > limit {
+				// If the limit has already passed, there is no time left
+				// to wait, which the check below reports.
+				wait = ClampDuration(limit, 0, 0)
+			}
+		}
+		wait = args.deadlineWait(wait)
+		if args.MaxDelayedAttempts > 0 && delayed >= args.MaxDelayedAttempts {
+			wait = 0
+		}
+		if args.MinInterval > 0 {
+			if gap := args.MinInterval - args.Clock.Now().Sub(attemptStart); wait < gap {
+				wait = gap
+			}
+		}
+		if wait > 0 {
+			delayed++
+		}
+		if final {
+			args.notifyDelay(state, 0, false)
+			if limited && wait > remaining {
+				break
+			}
+			if args.Metrics != nil {
+				args.Metrics.Delayed(wait)
+			}
+			// The attempts have run out whether or not the final delay
+			// is interrupted.
+			if args.WaitFunc != nil {
+				if _, waitErr := args.waitFor(); waitErr != nil {
+					return attempts, errors.Annotate(waitErr, "waiting for next attempt")
+				}
+			} else if args.sleep(wait) == sleepBrokenClock {
+				return attempts, brokenClock()
+			}
+			break
+		}
+		if limited && wait > remaining {
+			args.notifyDelay(state, 0, false)
+			return attempts, errors.Wrap(err, &DurationExceeded{
+				LastError: err,
+				Errors:    copyErrors(errs),
+				Elapsed:   args.Clock.Now().Sub(start),
+				Remaining: remaining,
+			})
+		}
+		args.notifyDelay(state, wait, true)
+		if args.Metrics != nil {
+			args.Metrics.Delayed(wait)
+		}
+		result := sleepCompleted
+		if args.WaitFunc != nil {
+			var waitErr error
+			if result, waitErr = args.waitFor(); waitErr != nil {
+				return attempts, errors.Annotate(waitErr, "waiting for next attempt")
+			}
+		} else {
+			// Wait for the delay, and retry
+			result = args.sleep(wait)
+		}
+		if result != sleepCompleted {
+			return args.interrupted(result, i, start, err, errs)
+		}
+	}
+	exceeded := &AttemptsExceeded{
+		LastError: err,
+		Errors:    copyErrors(errs),
+		Elapsed:   args.Clock.Now().Sub(start),
+		Attempts:  attempts,
+		format:    args.ErrorFormatter,
+	}
+	if args.JoinErrors {
+		exceeded.joined = &joinedErrors{errs: copyErrors(errs)}
+		// Wrapping the joined errors, rather than the last error, means
+		// that errors.Is and errors.As look at every error, even before
+		// getting the cause.
+		return attempts, errors.Wrap(exceeded.joined, exceeded)
+	}
+	return attempts, errors.Wrap(err, exceeded)
+}
+
+// backoff returns the delay to use after the given number of failures since
+// the backoff was last reset, based on the previous delay.
+func (args *CallArgs) backoff(delay time.Duration, step int, factor float64) time.Duration {
+	if n := len(args.Schedule); n > 0 {
+		if step > n {
+			step = n
+		}
+		delay = args.Schedule[step-1]
+	} else if args.BackoffFunc != nil {
+		delay = args.BackoffFunc(delay, step)
+	} else if step > 1 {
+		delay = ScaleDuration(delay, args.MaxDelay, factor)
+	} else if args.MaxDelay > 0 && delay > args.MaxDelay {
+		// The first delay has always been the Delay, even when the
+		// MaxDelay is less than it.
+		return ClampDuration(delay, args.MinDelay, 0)
+	}
+	return ClampDuration(delay, args.MinDelay, args.MaxDelay)
+}
+
+// remaining returns the time left before the MaxDuration or Deadline is
+// reached, and whether either of them is set.
+func (args *CallArgs) remaining(start time.Time) (time.Duration, bool) {
+	switch {
+	case args.MaxDuration > 0:
+		return args.MaxDuration - args.Clock.Now().Sub(start), true
+	case !args.Deadline.IsZero():
+		return args.Deadline.Sub(args.Clock.Now()), true
+	}
+	return 0, false
+}
+
+// deadlineWait returns the wait shortened to end DeadlineMargin before the
+// deadline of the Context, if it would otherwise end after that.
+func (args *CallArgs) deadlineWait(wait time.Duration) time.Duration {
+	if args.DeadlineMargin <= 0 || args.Context == nil {
+		return wait
+	}
+	deadline, ok := args.Context.Deadline()
+	if !ok {
+		return wait
+	}
+	latest := deadline.Sub(args.Clock.Now()) - args.DeadlineMargin
+	if latest <= 0 || wait <= latest {
+		return wait
+	}
+	return latest
+}
+
+// sleepResult describes how a sleep between attempts ended.
+type sleepResult int
+
+const (
+	sleepCompleted sleepResult = iota
+	sleepStopped
+	sleepCancelled
+	// sleepBrokenClock means that the After of the Clock returned a nil
+	// channel, which would never receive.
+	sleepBrokenClock
+)
+
+// brokenClock returns the error for a Clock whose After returns a nil
+// channel.
+func brokenClock() error {
+	return errors.NotValidf("Clock with After returning a nil channel")
+}
+
+// Sleep waits for the duration, as measured by the clock, unless the stop
+// channel is closed first. It returns true if the wait was interrupted by
+// the stop channel. If the stop channel is already closed, Sleep returns
+// true straight away, even for a duration of zero. If the After of the
+// clock returns a nil channel, Sleep returns false straight away. This is
+// the same wait that Call uses between attempts.
+func Sleep(clock clock.Clock, d time.Duration, stop <-chan struct{}) (interrupted bool) {
+	return wait(clock, d, stop, nil, nil) == sleepStopped
+}
+
+// sleep waits for the duration, unless interrupted by the Stop channel or
+// the Context. If the Clock is a Sleeper and there is no Stop channel, the
+// Sleeper is used so that no channel is allocated for the wait. The
+// Canceller is treated the same as the Stop channel.
+func (args *CallArgs) sleep(d time.Duration) sleepResult {
+	if args.stats != nil {
+		start := args.Clock.Now()
+		defer func() {
+			args.stats.SleepTime += args.Clock.Now().Sub(start)
+		}()
+	}
+	sleeper, ok := args.Clock.(Sleeper)
+	if ok && d > 0 && args.Stop == nil && args.Canceller == nil {
+		ctx := args.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := sleeper.Sleep(ctx, d); err != nil && ctx.Err() != nil {
+			return sleepCancelled
+		}
+		return sleepCompleted
+	}
+	stop, cancelled, done := args.stopChannels()
+	return wait(args.Clock, d, stop, cancelled, done)
+}
+
+// stopChannels returns the channels that interrupt a wait: the Stop
+// channel, the Done channel of the Canceller, and the Done channel of the
+// Context. Any that are not set are nil.
+func (args *CallArgs) stopChannels() (stop, cancelled, done <-chan struct{}) {
+	if args.Context != nil {
+		done = args.Context.Done()
+	}
+	if args.Canceller != nil {
+		cancelled = args.Canceller.Done()
+	}
+	return args.Stop, cancelled, done
+}
+
+// wait waits for the duration using the clock, unless the stop or cancelled
+// channels are closed, which stop the wait, or the done channel is closed,
+// which cancels it. A duration of zero doesn't wait at all, but yields the
+// processor.
+func wait(clock clock.Clock, d time.Duration, stop, cancelled, done <-chan struct{}) sleepResult {
+	if d <= 0 {
+		// There is nothing to wait for, but yield so that a loop with no
+		// delay doesn't starve other goroutines, such as the one that
+		// would close the Stop channel.
 		select {
-		case <-args.Clock.After(args.Delay):
-		case <-args.Stop:
-			return RetryStopped
+		case <-stop:
+			return sleepStopped
+		case <-cancelled:
+			return sleepStopped
+		case <-done:
+			return sleepCancelled
+		default:
+		}
+		yield()
+		return sleepCompleted
+	}
+	var after <-chan time.Time
+	if timer := newTimer(clock, d); timer != nil {
+		// Stopping the timer frees it straight away if the wait is
+		// interrupted.
+		defer timer.Stop()
+		after = timer.Chan()
+	} else {
+		after = clock.After(d)
+	}
+	if after == nil {
+		return sleepBrokenClock
+	}
+	// If the loop was stopped before the wait started, that takes priority
+	// over a delay that is already over.
+	select {
+	case <-stop:
+		return sleepStopped
+	case <-cancelled:
+		return sleepStopped
+	case <-done:
+		return sleepCancelled
+	default:
+	}
+	select {
+	case <-after:
+		return sleepCompleted
+	case <-stop:
+		return sleepStopped
+	case <-cancelled:
+		return sleepStopped
+	case <-done:
+		return sleepCancelled
+	}
+}
+
+// interrupted returns the result of Call when the wait after the attempt
+// did not complete.
+func (args *CallArgs) interrupted(result sleepResult, attempt int, start time.Time, err error, errs []error) (int, error) {
+	switch result {
+	case sleepStopped:
+		if args.FinalAttemptOnStop {
+			return args.finalAttempt(attempt+1, start)
 		}
+		return attempt, &RetryStopped{
+			LastError: err,
+			Errors:    copyErrors(errs),
+			Elapsed:   args.Clock.Now().Sub(start),
+		}
+	case sleepCancelled:
+		if args.FinalAttemptOnStop {
+			return args.finalAttempt(attempt+1, start)
+		}
+		return attempt, errors.Trace(args.Context.Err())
+	case sleepBrokenClock:
+		return attempt, brokenClock()
+	}
+	return attempt, errors.Errorf("unexpected sleep result %d", result)
+}
+
+// finalAttempt makes one last call to Func once the loop has been stopped,
+// returning its result rather than the stop error.
+func (args *CallArgs) finalAttempt(attempt int, start time.Time) (int, error) {
+	if err := args.call(attempt); err != nil {
+		return attempt, errors.Trace(err)
+	}
+	if args.SuccessFunc != nil {
+		args.SuccessFunc(attempt, args.Clock.Now().Sub(start))
+	}
+	return attempt, nil
+}
+
+// notifyDelay calls the NotifyFuncWithDelay, NotifyFuncV2 and
+// NotifyFuncWithState, if they are set, and logs the attempt to the Logger.
+func (args *CallArgs) notifyDelay(state State, nextDelay time.Duration, willRetry bool) {
+	args.logAttempt(state.Err, state.Attempt, nextDelay)
+	if args.NotifyFuncWithDelay != nil {
+		args.NotifyFuncWithDelay(state.Err, state.Attempt, nextDelay)
+	}
+	state.NextDelay = nextDelay
+	args.notifyV2(state, willRetry)
+}
+
+// notifyV2 calls the NotifyFuncV2 and NotifyFuncWithState, if they are set.
+func (args *CallArgs) notifyV2(state State, willRetry bool) {
+	state.WillRetry = willRetry
+	if args.NotifyFuncV2 != nil {
+		args.NotifyFuncV2(state.Err, state.Attempt, willRetry, state.SameAsPrevious)
+	}
+	if args.NotifyFuncWithState != nil {
+		args.NotifyFuncWithState(state)
+	}
+}
+
+// sameError returns true if the error is the same as the previous error,
+// according to the SameError, or errors.Is or the message if it is not set.
+func (args *CallArgs) sameError(err, previous error) bool {
+	if args.SameError != nil {
+		return args.SameError(err, previous)
+	}
+	return stderrors.Is(err, errors.Cause(previous)) || err.Error() == previous.Error()
+}
+
+// isFatal returns true if the error should not be retried, according to the
+// IsFatalErrorWithAttempt or IsFatalError. If neither is set, an error from
+// the Context being done is fatal.
+func (args *CallArgs) isFatal(err error, attempt int) bool {
+	if args.IsFatalErrorWithAttempt != nil {
+		return args.IsFatalErrorWithAttempt(err, attempt)
+	}
+	if args.IsFatalError != nil {
+		return args.IsFatalError(err)
+	}
+	return args.Context != nil && args.Context.Err() != nil && isContextError(err)
+}
 
-		args.Delay = ScaleDuration(args.Delay, args.MaxDelay, args.BackoffFactor)
+// isContextError returns true if the error is, or wraps, context.Canceled
+// or context.DeadlineExceeded.
+func isContextError(err error) bool {
+	return stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded)
+}
+
+// validateFunc checks that exactly one of Func, FuncWithAttempt and FuncCtx
+// has been set, naming the ones that conflict if there is more than one. A
+// FuncCtx doesn't need a Context, as it is given the background context if
+// there isn't one.
+func (args *CallArgs) validateFunc() error {
+	var set []string
+	if args.Func != nil {
+		set = append(set, "Func")
+	}
+	if args.FuncWithAttempt != nil {
+		set = append(set, "FuncWithAttempt")
+	}
+	if args.FuncCtx != nil {
+		set = append(set, "FuncCtx")
+	}
+	switch len(set) {
+	case 0:
+		return errors.NotValidf("missing Func, FuncWithAttempt or FuncCtx")
+	case 1:
+		return nil
+	case 2:
+		return errors.NotValidf("setting both %s and %s", set[0], set[1])
 	}
-	return errors.Wrap(err, &AttemptsExceeded{err})
+	return errors.NotValidf("setting all of %s", strings.Join(set, ", "))
+}
+
+// call calls whichever of Func, FuncWithAttempt or FuncCtx has been set,
+// giving up waiting for it if it takes longer than the AttemptTimeout.
+func (args *CallArgs) call(attempt int) (err error) {
+	if args.Metrics != nil {
+		args.Metrics.AttemptStarted()
+		defer func() {
+			if err != nil {
+				args.Metrics.AttemptFailed(err)
+			}
+		}()
+	}
+	if args.stats != nil {
+		start := args.Clock.Now()
+		defer func() {
+			args.stats.FuncTime += args.Clock.Now().Sub(start)
+		}()
+	}
+	ctx := args.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = withAttempt(ctx, attempt)
+	if args.FuncCtx != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = args.withStop(ctx)
+		defer cancel()
+	}
+	callFunc := args.execute
+	if args.HedgeAfter > 0 {
+		callFunc = args.hedge
+	}
+	if args.AttemptTimeout <= 0 {
+		return callFunc(ctx, attempt)
+	}
+	if args.FuncCtx != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, args.AttemptTimeout)
+		// Cancelling the context when the attempt is over tells a FuncCtx
+		// that has timed out to give up.
+		defer cancel()
+	}
+	timeout := args.Clock.After(args.AttemptTimeout)
+	if timeout == nil {
+		// Waiting on a nil channel would never time out.
+		return Abort(brokenClock())
+	}
+	result := make(chan execution)
+	// abandoned is closed once the attempt has timed out, so that the
+	// goroutine can exit once the Func returns.
+	abandoned := make(chan struct{})
+	go func() {
+		returned := false
+		defer func() {
+			if returned {
+				return
+			}
+			r := recover()
+			select {
+			case result <- execution{panicked: true, value: r}:
+			case <-abandoned:
+				// No one is waiting for the attempt any more, so the
+				// panic carries on here.
+				panic(r)
+			}
+		}()
+		err := callFunc(ctx, attempt)
+		returned = true
+		select {
+		case result <- execution{err: err}:
+		case <-abandoned:
+		}
+	}()
+	select {
+	case outcome := <-result:
+		if outcome.panicked {
+			// The panic carries on from the goroutine that called Call,
+			// as it would without the AttemptTimeout.
+			panic(outcome.value)
+		}
+		return outcome.err
+	case <-timeout:
+		close(abandoned)
+		return &AttemptTimedOut{args.AttemptTimeout}
+	}
+}
+
+// callFunc calls whichever of Func, FuncWithAttempt or FuncCtx has been set,
+// between the StartAttempt and the end function that it returns.
+func (args *CallArgs) callFunc(ctx context.Context, attempt int) (err error) {
+	if args.StartAttempt != nil {
+		if end := args.StartAttempt(attempt); end != nil {
+			defer func() {
+				if r := recover(); r != nil {
+					end(fmt.Errorf("panic: %v", r))
+					panic(r)
+				}
+				end(err)
+			}()
+		}
+	}
+	if args.RecoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+	}
+	if args.FuncWithAttempt != nil {
+		return args.FuncWithAttempt(attempt)
+	}
+	if args.FuncCtx != nil {
+		return args.FuncCtx(ctx)
+	}
+	if args.Func == nil {
+		// Validate makes sure this can't happen, but if it does, stopping
+		// with the same error is better than a panic.
+		return Abort(errors.NotValidf("missing Func, FuncWithAttempt or FuncCtx"))
+	}
+	return args.Func()
+}
+
+// copyErrors returns a copy of the errors so the slice given to the caller
+// doesn't share its storage with the retry loop.
+func copyErrors(errs []error) []error {
+	return append([]error(nil), errs...)
+}
+
+// randFloat64 is the source of randomness for the jitter and the spread of
+// the first attempt when there is no Rand. It is a variable so the tests can
+// make the delays predictable.
+var randFloat64 = rand.Float64
+
+// random returns a random number in the range [0, 1) from the Rand, or
+// from randFloat64 if the Rand is not set.
+func (args *CallArgs) random() float64 {
+	return randomFrom(args.Rand)
+}
+
+// randomFrom returns a random number in the range [0, 1) from r, or from
+// randFloat64 if r is nil.
+func randomFrom(r *rand.Rand) float64 {
+	if r != nil {
+		return r.Float64()
+	}
+	return randFloat64()
+}
+
+// yield is called instead of waiting when the delay is zero. It is a
+// variable so the tests can check that it is called.
+var yield = runtime.Gosched
+
+// jitter returns a random duration in the range (delay*(1-factor), delay].
+func (args *CallArgs) jitter(delay time.Duration, factor float64) time.Duration {
+	return delay - time.Duration(args.random()*factor*float64(delay))
+}
+
+// jitterFactor returns the fraction of the delay that may be removed by the
+// jitter, which is zero if there is no jitter.
+func (args *CallArgs) jitterFactor() float64 {
+	if args.Jitter {
+		return 0.5
+	}
+	return args.JitterFactor
 }
 
 // ScaleDuration scale up the `current` duration by a factor of `scale`, with
 // a capped value of `max`. If `max` is zero, it means there is no maximum
-// duration.
+// duration. A result too large to be represented as a time.Duration is
+// capped at `max`, or the largest possible time.Duration if there is no
+// maximum.
 func ScaleDuration(current, max time.Duration, scale float64) time.Duration {
 	// Any overhead that we may possibly incur by multiplying something by one,
 	// is more than overcome by the sleeping that will occur.
 
 	// Since scale may be something like 1.5, or 2 and time.Duration is an
 	// int64, we need a little casting here. Also, a negative scale is treated
-	// as positive.
-	duration := (time.Duration)((float64)(current) * math.Abs(scale))
+	// as positive. The multiplication is done as a float so that it cannot
+	// overflow, and is checked before converting back to a duration.
+	scaled := (float64)(current) * math.Abs(scale)
+	if scaled >= math.MaxInt64 {
+		if max > 0 {
+			return max
+		}
+		return math.MaxInt64
+	}
+	duration := (time.Duration)(scaled)
 	if duration > max && max > 0 {
 		return max
 	}
 	return duration
 }
+
+// ClampDuration constrains the `current` duration to be no less than `min`
+// and no more than `max`. If `min` is zero, there is no minimum duration, and
+// if `max` is zero, there is no maximum duration.
+func ClampDuration(current, min, max time.Duration) time.Duration {
+	if current < min {
+		current = min
+	}
+	if current > max && max > 0 {
+		current = max
+	}
+	return current
+}
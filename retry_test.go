@@ -4,6 +4,15 @@
 package retry_test
 
 import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/juju/errors"
@@ -16,24 +25,61 @@ import (
 )
 
 type retrySuite struct {
-	testing.LoggingSuite
+	testing.IsolationSuite
 }
 
 var _ = gc.Suite(&retrySuite{})
 
+// mockClock records the delays it is asked to wait for, and advances its
+// notion of the current time by each delay.
 type mockClock struct {
+	now    time.Time
 	delays []time.Duration
 }
 
-func (*mockClock) Now() time.Time {
-	return time.Now()
+func (mock *mockClock) Now() time.Time {
+	return mock.now
 }
 
 func (mock *mockClock) After(wait time.Duration) <-chan time.Time {
 	mock.delays = append(mock.delays, wait)
+	mock.now = mock.now.Add(wait)
 	return time.After(time.Microsecond)
 }
 
+// sleeperClock is a mockClock that also implements retry.Sleeper.
+type sleeperClock struct {
+	mockClock
+	slept []time.Duration
+}
+
+func (mock *sleeperClock) Sleep(ctx context.Context, d time.Duration) error {
+	mock.slept = append(mock.slept, d)
+	return ctx.Err()
+}
+
+// allocatingClock returns a new channel from After, like the wall clock.
+type allocatingClock struct{}
+
+func (allocatingClock) Now() time.Time {
+	return time.Time{}
+}
+
+func (allocatingClock) After(time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+// noopSleeper sleeps without allocating or waiting.
+type noopSleeper struct {
+	allocatingClock
+}
+
+func (noopSleeper) Sleep(context.Context, time.Duration) error {
+	return nil
+}
+
 func (*retrySuite) TestSuccessHasNoDelay(c *gc.C) {
 	clock := &mockClock{}
 	err := retry.Call(retry.CallArgs{
@@ -46,6 +92,45 @@ func (*retrySuite) TestSuccessHasNoDelay(c *gc.C) {
 	c.Assert(clock.delays, gc.HasLen, 0)
 }
 
+func (*retrySuite) TestCallCount(c *gc.C) {
+	clock := &mockClock{}
+	count, err := retry.CallCount(retry.CallArgs{
+		Func:     func() error { return nil },
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 1)
+
+	calls := 0
+	count, err = retry.CallCount(retry.CallArgs{
+		Func: func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("bah")
+			}
+			return nil
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (*retrySuite) TestCallCountAttemptsExceeded(c *gc.C) {
+	count, err := retry.CallCount(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 4,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 4)
+}
+
 func (*retrySuite) TestCalledOnceEvenIfStopped(c *gc.C) {
 	stop := make(chan struct{})
 	clock := &mockClock{}
@@ -66,6 +151,19 @@ func (*retrySuite) TestCalledOnceEvenIfStopped(c *gc.C) {
 	c.Assert(clock.delays, gc.HasLen, 0)
 }
 
+func (*retrySuite) TestStoppedAfterAttemptIsNotNotAttempted(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 5,
+		Delay:    time.Hour,
+		Stop:     stop,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(err, gc.Not(jc.Satisfies), retry.IsNotAttempted)
+}
+
 func (*retrySuite) TestAttempts(c *gc.C) {
 	clock := &mockClock{}
 	funcErr := errors.New("bah")
@@ -84,6 +182,89 @@ func (*retrySuite) TestAttempts(c *gc.C) {
 	})
 }
 
+func (*retrySuite) TestIncludeFinalDelay(c *gc.C) {
+	clock := &mockClock{}
+	var nextDelays []time.Duration
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Attempts:      3,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		Clock:         clock,
+		NotifyFuncWithDelay: func(_ error, _ int, nextDelay time.Duration) {
+			nextDelays = append(nextDelays, nextDelay)
+		},
+		IncludeFinalDelay: true,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The delay after the last attempt is waited for too.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+	})
+	// There is no next attempt to tell the NotifyFuncWithDelay about.
+	c.Assert(nextDelays, jc.DeepEquals, []time.Duration{time.Minute, 2 * time.Minute, 0})
+	c.Assert(errors.Cause(err).(*retry.AttemptsExceeded).Elapsed, gc.Equals, 7*time.Minute)
+}
+
+func (*retrySuite) TestIncludeFinalDelayMaxDuration(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:              func() error { return errors.New("bah") },
+		Attempts:          3,
+		Delay:             time.Minute,
+		BackoffFactor:     2,
+		MaxDuration:       5 * time.Minute,
+		Clock:             clock,
+		IncludeFinalDelay: true,
+	})
+	// The final delay would pass the MaxDuration, so it isn't waited for,
+	// but the attempts have still run out.
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute, 2 * time.Minute})
+}
+
+func (*retrySuite) TestIncludeFinalDelayStopped(c *gc.C) {
+	stop := make(chan struct{})
+	clock := &mockClock{}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 2 {
+				close(stop)
+			}
+			return errors.New("bah")
+		},
+		Attempts:          2,
+		Delay:             time.Minute,
+		Stop:              stop,
+		Clock:             clock,
+		IncludeFinalDelay: true,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 2)
+}
+
+func (*retrySuite) TestElapsed(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			clock.now = clock.now.Add(time.Second)
+			return errors.New("bah")
+		},
+		Attempts: 4,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	retryError := errors.Cause(err).(*retry.AttemptsExceeded)
+	// The time spent in each call is included, as are the delays between
+	// the attempts, but there is no delay after the final attempt.
+	c.Assert(retryError.Elapsed, gc.Equals, 3*time.Minute+4*time.Second)
+}
+
 func (*retrySuite) TestAttemptsExceededError(c *gc.C) {
 	clock := &mockClock{}
 	funcErr := errors.New("bah")
@@ -100,197 +281,2827 @@ func (*retrySuite) TestAttemptsExceededError(c *gc.C) {
 	c.Assert(retryError.LastError, gc.Equals, funcErr)
 }
 
-func (*retrySuite) TestFatalErrorsNotRetried(c *gc.C) {
+func (*retrySuite) TestAttemptsExceededAllErrors(c *gc.C) {
 	clock := &mockClock{}
-	funcErr := errors.New("bah")
+	var funcErrors []error
 	err := retry.Call(retry.CallArgs{
-		Func:         func() error { return funcErr },
-		IsFatalError: func(error) bool { return true },
-		Attempts:     5,
-		Delay:        time.Minute,
-		Clock:        clock,
+		Func: func() error {
+			err := errors.Errorf("bah %d", len(funcErrors))
+			funcErrors = append(funcErrors, err)
+			return err
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    clock,
 	})
-	c.Assert(errors.Cause(err), gc.Equals, funcErr)
-	c.Assert(clock.delays, gc.HasLen, 0)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: bah 2`)
+	retryError, _ := errors.Cause(err).(*retry.AttemptsExceeded)
+	c.Assert(retryError.Errors, jc.DeepEquals, funcErrors)
+	c.Assert(retryError.LastError, gc.Equals, funcErrors[2])
 }
 
-func (*retrySuite) TestBackoffFactor(c *gc.C) {
+func (*retrySuite) TestInitialDelay(c *gc.C) {
 	clock := &mockClock{}
 	err := retry.Call(retry.CallArgs{
 		Func:          func() error { return errors.New("bah") },
-		Clock:         clock,
-		Attempts:      5,
+		Attempts:      3,
 		Delay:         time.Minute,
+		InitialDelay:  10 * time.Second,
 		BackoffFactor: 2,
+		Clock:         clock,
 	})
 	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
 	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		10 * time.Second,
 		time.Minute,
-		time.Minute * 2,
-		time.Minute * 4,
-		time.Minute * 8,
+		2 * time.Minute,
 	})
 }
 
-func (*retrySuite) TestStopChannel(c *gc.C) {
-	clock := &mockClock{}
+func (*retrySuite) TestInitialDelayStopped(c *gc.C) {
 	stop := make(chan struct{})
-	count := 0
+	close(stop)
+	called := false
 	err := retry.Call(retry.CallArgs{
 		Func: func() error {
-			if count == 2 {
-				close(stop)
-			}
-			count++
-			return errors.New("bah")
+			called = true
+			return nil
 		},
-		Attempts: 5,
-		Delay:    time.Minute,
-		Clock:    clock,
-		Stop:     stop,
+		Attempts:     3,
+		Delay:        time.Minute,
+		InitialDelay: time.Hour,
+		Stop:         stop,
 	})
 	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
-	c.Assert(clock.delays, gc.HasLen, 3)
+	c.Assert(errors.Cause(err).(*retry.RetryStopped).LastError, gc.IsNil)
+	c.Assert(err, jc.Satisfies, retry.IsNotAttempted)
+	c.Assert(called, jc.IsFalse)
 }
 
-func (*retrySuite) TestNotifyFunc(c *gc.C) {
-	var (
-		clock      = &mockClock{}
-		funcErr    = errors.New("bah")
-		attempts   []int
-		funcErrors []error
-	)
+func (*retrySuite) TestInitialDelayCancelled(c *gc.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	called := false
 	err := retry.Call(retry.CallArgs{
 		Func: func() error {
-			return funcErr
-		},
-		NotifyFunc: func(lastError error, attempt int) {
-			funcErrors = append(funcErrors, lastError)
-			attempts = append(attempts, attempt)
+			called = true
+			return nil
 		},
-		Attempts: 3,
-		Delay:    time.Minute,
-		Clock:    clock,
+		Attempts:     3,
+		Delay:        time.Minute,
+		InitialDelay: time.Hour,
+		Context:      ctx,
 	})
-	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
-	c.Assert(clock.delays, gc.HasLen, 2)
-	c.Assert(funcErrors, jc.DeepEquals, []error{funcErr, funcErr, funcErr})
-	c.Assert(attempts, jc.DeepEquals, []int{1, 2, 3})
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+	c.Assert(err, jc.Satisfies, retry.IsNotAttempted)
+	c.Assert(called, jc.IsFalse)
 }
 
-func (*retrySuite) TestInfiniteRetries(c *gc.C) {
-	// OK, we can't test infinite, but we'll go for lots.
+func (*retrySuite) TestFatalErrorsNotRetried(c *gc.C) {
 	clock := &mockClock{}
-	stop := make(chan struct{})
+	funcErr := errors.New("bah")
+	err := retry.Call(retry.CallArgs{
+		Func:         func() error { return funcErr },
+		IsFatalError: func(error) bool { return true },
+		Attempts:     5,
+		Delay:        time.Minute,
+		Clock:        clock,
+	})
+	c.Assert(errors.Cause(err), gc.Equals, funcErr)
+	c.Assert(clock.delays, gc.HasLen, 0)
+}
+
+func (*retrySuite) TestFatalFunc(c *gc.C) {
+	clock := &mockClock{}
+	funcErr := errors.New("bah")
+	var fatal []int
 	count := 0
 	err := retry.Call(retry.CallArgs{
 		Func: func() error {
-			if count == 111 {
-				close(stop)
-			}
 			count++
-			return errors.New("bah")
+			return funcErr
 		},
-		Attempts: retry.UnlimitedAttempts,
+		IsFatalError: func(error) bool { return count == 2 },
+		FatalFunc: func(err error, attempt int) {
+			c.Check(err, gc.Equals, funcErr)
+			fatal = append(fatal, attempt)
+		},
+		Attempts: 5,
 		Delay:    time.Minute,
 		Clock:    clock,
-		Stop:     stop,
 	})
-	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
-	c.Assert(clock.delays, gc.HasLen, count)
+	c.Assert(errors.Cause(err), gc.Equals, funcErr)
+	c.Assert(fatal, jc.DeepEquals, []int{2})
+	c.Assert(clock.delays, gc.HasLen, 1)
 }
 
-func (*retrySuite) TestMaxDelay(c *gc.C) {
-	clock := &mockClock{}
+func (*retrySuite) TestFatalFuncNotCalled(c *gc.C) {
+	fatalFunc := func(error, int) {
+		c.Errorf("FatalFunc called")
+	}
 	err := retry.Call(retry.CallArgs{
-		Func:          func() error { return errors.New("bah") },
-		Attempts:      7,
-		Delay:         time.Minute,
-		MaxDelay:      10 * time.Minute,
-		BackoffFactor: 2,
-		Clock:         clock,
+		Func:         func() error { return errors.New("bah") },
+		IsFatalError: func(error) bool { return false },
+		FatalFunc:    fatalFunc,
+		Attempts:     3,
+		Delay:        time.Minute,
+		Clock:        &mockClock{},
 	})
 	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
-	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
-		time.Minute,
-		2 * time.Minute,
-		4 * time.Minute,
-		8 * time.Minute,
-		10 * time.Minute,
-		10 * time.Minute,
+
+	err = retry.Call(retry.CallArgs{
+		Func:             func() error { return errors.New("bah") },
+		IsRetryableError: func(error) bool { return false },
+		FatalFunc:        fatalFunc,
+		Attempts:         3,
+		Delay:            time.Minute,
+		Clock:            &mockClock{},
 	})
+	c.Assert(err, gc.ErrorMatches, `bah`)
 }
 
-func (*retrySuite) TestWithWallClock(c *gc.C) {
-	var attempts []int
+func (*retrySuite) TestFatalErrorWithAttempt(c *gc.C) {
+	clock := &mockClock{}
+	authErr := errors.New("auth failed")
+	count := 0
 	err := retry.Call(retry.CallArgs{
-		Func: func() error { return errors.New("bah") },
-		NotifyFunc: func(lastError error, attempt int) {
-			attempts = append(attempts, attempt)
+		Func: func() error {
+			count++
+			return authErr
+		},
+		// IsFatalError is ignored when IsFatalErrorWithAttempt is set.
+		IsFatalError: func(error) bool { return true },
+		IsFatalErrorWithAttempt: func(err error, attempt int) bool {
+			return err == authErr && attempt > 2
 		},
 		Attempts: 5,
-		Delay:    time.Microsecond,
+		Delay:    time.Minute,
+		Clock:    clock,
 	})
-	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
-	c.Assert(attempts, jc.DeepEquals, []int{1, 2, 3, 4, 5})
+	c.Assert(errors.Cause(err), gc.Equals, authErr)
+	c.Assert(count, gc.Equals, 3)
+	c.Assert(clock.delays, gc.HasLen, 2)
 }
 
-func (*retrySuite) TestMissingFuncNotValid(c *gc.C) {
+func (*retrySuite) TestRetryableErrorsRetried(c *gc.C) {
+	clock := &mockClock{}
+	transient := errors.New("transient")
+	fatal := errors.New("fatal")
+	count := 0
 	err := retry.Call(retry.CallArgs{
-		Attempts: 5,
-		Delay:    time.Minute,
+		Func: func() error {
+			count++
+			if count < 3 {
+				return transient
+			}
+			return fatal
+		},
+		IsRetryableError: func(err error) bool { return err == transient },
+		Attempts:         5,
+		Delay:            time.Minute,
+		Clock:            clock,
 	})
-	c.Check(err, jc.Satisfies, errors.IsNotValid)
-	c.Check(err, gc.ErrorMatches, `missing Func not valid`)
+	c.Assert(errors.Cause(err), gc.Equals, fatal)
+	c.Assert(count, gc.Equals, 3)
+	c.Assert(clock.delays, gc.HasLen, 2)
 }
 
-func (*retrySuite) TestMissingAttemptsNotValid(c *gc.C) {
+func (*retrySuite) TestFatalAndRetryableErrorNotValid(c *gc.C) {
 	err := retry.Call(retry.CallArgs{
-		Func:  func() error { return errors.New("bah") },
-		Delay: time.Minute,
+		Func:             func() error { return errors.New("bah") },
+		IsFatalError:     func(error) bool { return true },
+		IsRetryableError: func(error) bool { return true },
+		Attempts:         5,
+		Delay:            time.Minute,
 	})
 	c.Check(err, jc.Satisfies, errors.IsNotValid)
-	c.Check(err, gc.ErrorMatches, `missing Attempts not valid`)
-}
+	c.Check(err, gc.ErrorMatches, `setting both IsFatalError and IsRetryableError not valid`)
 
-func (*retrySuite) TestMissingDelayNotValid(c *gc.C) {
-	err := retry.Call(retry.CallArgs{
-		Func:     func() error { return errors.New("bah") },
-		Attempts: 5,
+	err = retry.Call(retry.CallArgs{
+		Func:                    func() error { return errors.New("bah") },
+		IsFatalErrorWithAttempt: func(error, int) bool { return true },
+		IsRetryableError:        func(error) bool { return true },
+		Attempts:                5,
+		Delay:                   time.Minute,
 	})
 	c.Check(err, jc.Satisfies, errors.IsNotValid)
-	c.Check(err, gc.ErrorMatches, `missing Delay not valid`)
+	c.Check(err, gc.ErrorMatches, `setting both IsFatalError and IsRetryableError not valid`)
 }
 
-func (*retrySuite) TestBackoffErrors(c *gc.C) {
-	// Backoff values of less than one are a validation error.
-	for _, factor := range []float64{-2, 0.5} {
-		err := retry.Call(retry.CallArgs{
-			Func:          func() error { return errors.New("bah") },
-			Attempts:      5,
-			Delay:         time.Minute,
-			BackoffFactor: factor,
+func (*retrySuite) TestBackoffFactor(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Clock:         clock,
+		Attempts:      5,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		time.Minute * 2,
+		time.Minute * 4,
+		time.Minute * 8,
+	})
+}
+
+func (s *retrySuite) TestJitter(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.5 })
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Clock:         clock,
+		Attempts:      5,
+		Delay:         time.Minute,
+		MaxDelay:      6 * time.Minute,
+		BackoffFactor: 2,
+		Jitter:        true,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		45 * time.Second,
+		90 * time.Second,
+		3 * time.Minute,
+		// The jitter is applied to the capped delay.
+		4*time.Minute + 30*time.Second,
+	})
+}
+
+func (s *retrySuite) TestJitterRange(c *gc.C) {
+	for _, value := range []float64{0, 0.999999} {
+		s.PatchValue(retry.RandFloat64, func() float64 { return value })
+		clock := &mockClock{}
+		err := retry.Call(retry.CallArgs{
+			Func:     func() error { return errors.New("bah") },
+			Clock:    clock,
+			Attempts: 2,
+			Delay:    time.Minute,
+			Jitter:   true,
+		})
+		c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+		c.Assert(clock.delays, gc.HasLen, 1)
+		c.Check(clock.delays[0] <= time.Minute, jc.IsTrue)
+		c.Check(clock.delays[0] > 30*time.Second, jc.IsTrue)
+	}
+}
+
+func (*retrySuite) TestDelayFunc(c *gc.C) {
+	type retryAfter struct {
+		error
+		delay time.Duration
+	}
+	var (
+		clock    = &mockClock{}
+		count    = 0
+		defaults []time.Duration
+	)
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 2 {
+				return retryAfter{errors.New("slow down"), 30 * time.Second}
+			}
+			if count == 3 {
+				return retryAfter{errors.New("slow down"), time.Hour}
+			}
+			return errors.New("bah")
+		},
+		DelayFunc: func(err error, attempt int, defaultDelay time.Duration) time.Duration {
+			defaults = append(defaults, defaultDelay)
+			if hint, ok := err.(retryAfter); ok {
+				return hint.delay
+			}
+			return defaultDelay
+		},
+		Attempts:      5,
+		Delay:         time.Minute,
+		MaxDelay:      10 * time.Minute,
+		BackoffFactor: 2,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(defaults, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		8 * time.Minute,
+	})
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		30 * time.Second,
+		// The hint is still capped by the MaxDelay.
+		10 * time.Minute,
+		8 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestResetAfter(c *gc.C) {
+	clock := &mockClock{}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 4 {
+				// This call runs long enough to reset the backoff.
+				clock.now = clock.now.Add(time.Hour)
+			}
+			return errors.New("bah")
+		},
+		Attempts:      7,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		ResetAfter:    time.Hour,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestAttemptTimeout(c *gc.C) {
+	block := make(chan struct{})
+	defer close(block)
+	var attempts []int
+	count, err := retry.CallCount(retry.CallArgs{
+		FuncWithAttempt: func(attempt int) error {
+			if attempt == 1 {
+				<-block
+			}
+			return nil
+		},
+		NotifyFunc: func(lastError error, attempt int) {
+			attempts = append(attempts, attempt)
+			c.Check(lastError, jc.Satisfies, retry.IsAttemptTimeout)
+			c.Check(lastError, gc.ErrorMatches, `attempt timed out after 50ms`)
+		},
+		Attempts:       3,
+		Delay:          time.Microsecond,
+		AttemptTimeout: 50 * time.Millisecond,
+	})
+	// The first attempt blocks so it times out, but the second succeeds.
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 2)
+	c.Assert(attempts, jc.DeepEquals, []int{1})
+}
+
+func (*retrySuite) TestAttemptTimeoutAttemptsExceeded(c *gc.C) {
+	block := make(chan struct{})
+	defer close(block)
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			<-block
+			return nil
+		},
+		Attempts:       2,
+		Delay:          time.Minute,
+		AttemptTimeout: 10 * time.Second,
+		Clock:          &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	lastError := errors.Cause(err).(*retry.AttemptsExceeded).LastError
+	c.Assert(lastError, jc.Satisfies, retry.IsAttemptTimeout)
+}
+
+func (*retrySuite) TestAttemptTimeoutPanic(c *gc.C) {
+	call := func() {
+		retry.Call(retry.CallArgs{
+			Func:           func() error { panic("bah") },
+			Attempts:       2,
+			Delay:          time.Minute,
+			AttemptTimeout: time.Minute,
+		})
+	}
+	// The panic reaches the caller rather than crashing the goroutine
+	// that made the attempt.
+	c.Assert(call, gc.PanicMatches, `bah`)
+}
+
+func (*retrySuite) TestAttemptTimeoutClockAfterNil(c *gc.C) {
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return nil
+		},
+		Attempts:       3,
+		Delay:          time.Minute,
+		AttemptTimeout: time.Minute,
+		Clock:          &nilAfterClock{},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `Clock with After returning a nil channel not valid`)
+	c.Assert(count, gc.Equals, 0)
+}
+
+func (s *retrySuite) TestJitterFactor(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.5 })
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Clock:         clock,
+		Attempts:      5,
+		Delay:         time.Minute,
+		MaxDelay:      6 * time.Minute,
+		BackoffFactor: 2,
+		JitterFactor:  0.2,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// Each delay is reduced by a tenth.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		54 * time.Second,
+		108 * time.Second,
+		216 * time.Second,
+		324 * time.Second,
+	})
+}
+
+func (*retrySuite) TestJitterFactorErrors(c *gc.C) {
+	for _, factor := range []float64{-0.1, 1.5} {
+		err := retry.Call(retry.CallArgs{
+			Func:         func() error { return errors.New("bah") },
+			Attempts:     5,
+			Delay:        time.Minute,
+			JitterFactor: factor,
+		})
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, `JitterFactor of .* not valid`)
+	}
+	err := retry.Call(retry.CallArgs{
+		Func:         func() error { return errors.New("bah") },
+		Attempts:     5,
+		Delay:        time.Minute,
+		Jitter:       true,
+		JitterFactor: 0.5,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `setting both Jitter and JitterFactor not valid`)
+}
+
+func (*retrySuite) TestSleeperClock(c *gc.C) {
+	clock := &sleeperClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Attempts:      4,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, gc.HasLen, 0)
+	c.Assert(clock.slept, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestSleeperClockCancelled(c *gc.C) {
+	clock := &sleeperClock{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 2 {
+				cancel()
+			}
+			return errors.New("bah")
+		},
+		Attempts: 4,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Context:  ctx,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+	c.Assert(clock.slept, gc.HasLen, 2)
+}
+
+func (*retrySuite) TestSleeperClockNotUsedWithStop(c *gc.C) {
+	clock := &sleeperClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Stop:     make(chan struct{}),
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, gc.HasLen, 2)
+	c.Assert(clock.slept, gc.HasLen, 0)
+}
+
+func (*retrySuite) benchmarkCall(c *gc.C, clock clock.Clock) {
+	funcErr := errors.New("bah")
+	args := retry.CallArgs{
+		Func:     func() error { return funcErr },
+		Attempts: 100,
+		Delay:    time.Millisecond,
+		Clock:    clock,
+	}
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		retry.Call(args)
+	}
+}
+
+// Run the benchmarks with -check.b -check.bmem to see the allocations
+// saved by using a Sleeper.
+func (s *retrySuite) BenchmarkAfterClock(c *gc.C) {
+	s.benchmarkCall(c, allocatingClock{})
+}
+
+func (s *retrySuite) BenchmarkSleeperClock(c *gc.C) {
+	s.benchmarkCall(c, noopSleeper{})
+}
+
+// timerClock is a mockClock that also implements retry.TimerClock.
+type timerClock struct {
+	mockClock
+	timers  []time.Duration
+	stopped int
+}
+
+func (mock *timerClock) NewTimer(d time.Duration) retry.Timer {
+	mock.timers = append(mock.timers, d)
+	return &mockTimer{clock: mock, ch: mock.mockClock.After(d)}
+}
+
+type mockTimer struct {
+	clock *timerClock
+	ch    <-chan time.Time
+}
+
+func (t *mockTimer) Chan() <-chan time.Time {
+	return t.ch
+}
+
+func (t *mockTimer) Stop() bool {
+	t.clock.stopped++
+	return true
+}
+
+func (*retrySuite) TestTimerClock(c *gc.C) {
+	clock := &timerClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Stop:     make(chan struct{}),
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.timers, jc.DeepEquals, []time.Duration{time.Minute, time.Minute})
+	c.Assert(clock.stopped, gc.Equals, 2)
+}
+
+func (*retrySuite) TestTimerClockStopped(c *gc.C) {
+	clock := &timerClock{}
+	stop := make(chan struct{})
+	close(stop)
+	interrupted := retry.Sleep(clock, time.Hour, stop)
+	c.Assert(interrupted, jc.IsTrue)
+	// The timer is stopped rather than being left to run for the hour.
+	c.Assert(clock.timers, jc.DeepEquals, []time.Duration{time.Hour})
+	c.Assert(clock.stopped, gc.Equals, 1)
+}
+
+// afterOnlyClock is the wall clock without its Timer.
+type afterOnlyClock struct{}
+
+func (afterOnlyClock) Now() time.Time {
+	return time.Now()
+}
+
+func (afterOnlyClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func benchmarkStoppedSleep(c *gc.C, clock clock.Clock) {
+	stop := make(chan struct{})
+	close(stop)
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		retry.Sleep(clock, time.Hour, stop)
+	}
+}
+
+// Run the benchmarks with -check.b to compare stopped waits. With only
+// After, every stopped wait leaves an hour long timer behind, which before
+// Go 1.23 is not freed until it fires, whereas the Timer is stopped.
+func (*retrySuite) BenchmarkStoppedSleepAfter(c *gc.C) {
+	benchmarkStoppedSleep(c, afterOnlyClock{})
+}
+
+func (*retrySuite) BenchmarkStoppedSleepTimer(c *gc.C) {
+	benchmarkStoppedSleep(c, clock.WallClock)
+}
+
+func (*retrySuite) TestStopChannel(c *gc.C) {
+	clock := &mockClock{}
+	stop := make(chan struct{})
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			if count == 2 {
+				close(stop)
+			}
+			count++
+			return errors.Errorf("bah %d", count)
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Stop:     stop,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(clock.delays, gc.HasLen, 3)
+	retryError, _ := errors.Cause(err).(*retry.RetryStopped)
+	c.Assert(retryError.LastError, gc.ErrorMatches, `bah 3`)
+	c.Assert(retryError.Errors, gc.HasLen, 3)
+	c.Assert(retryError.Elapsed, gc.Equals, 3*time.Minute)
+}
+
+func (*retrySuite) TestStoppedBeforeWaitTakesPriority(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.New("bah")
+		},
+		Attempts: 2,
+		Delay:    time.Minute,
+		// The delay is over as soon as the wait starts, but the Stop
+		// channel was closed first, so it wins.
+		Clock: allocatingClock{},
+		Stop:  stop,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (*retrySuite) TestFinalAttemptOnStop(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	var attempts []int
+	count, err := retry.CallCount(retry.CallArgs{
+		FuncWithAttempt: func(attempt int) error {
+			attempts = append(attempts, attempt)
+			if attempt == 1 {
+				return errors.New("bah")
+			}
+			return nil
+		},
+		Attempts:           5,
+		Delay:              time.Hour,
+		Stop:               stop,
+		FinalAttemptOnStop: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 2)
+	c.Assert(attempts, jc.DeepEquals, []int{1, 2})
+}
+
+func (*retrySuite) TestFinalAttemptOnStopFails(c *gc.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.Errorf("bah %d", count)
+		},
+		Attempts:           5,
+		Delay:              time.Hour,
+		Context:            ctx,
+		FinalAttemptOnStop: true,
+	})
+	// The error from the final attempt is returned, not the stop error.
+	c.Assert(err, gc.ErrorMatches, `bah 2`)
+	c.Assert(count, gc.Equals, 2)
+}
+
+func (*retrySuite) TestContextCancelledBeforeFirstCall(c *gc.C) {
+	clock := &mockClock{}
+	called := false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			called = true
+			return nil
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Context:  ctx,
+	})
+	c.Assert(called, jc.IsFalse)
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+	c.Assert(err, jc.Satisfies, retry.IsNotAttempted)
+	c.Assert(err, gc.ErrorMatches, `not attempted: context canceled`)
+	c.Assert(errors.Cause(err), gc.Equals, context.Canceled)
+	c.Assert(stderrors.Is(err, context.Canceled), jc.IsTrue)
+	c.Assert(clock.delays, gc.HasLen, 0)
+}
+
+func (*retrySuite) TestContextCancelled(c *gc.C) {
+	clock := &mockClock{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			if count == 2 {
+				cancel()
+			}
+			count++
+			return errors.New("bah")
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Context:  ctx,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+	c.Assert(err, gc.Not(jc.Satisfies), retry.IsNotAttempted)
+	c.Assert(errors.Cause(err), gc.Equals, context.Canceled)
+	c.Assert(count, gc.Equals, 3)
+	c.Assert(clock.delays, gc.HasLen, 3)
+}
+
+func (*retrySuite) TestContextWithStop(c *gc.C) {
+	clock := &mockClock{}
+	stop := make(chan struct{})
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			if count == 2 {
+				close(stop)
+			}
+			count++
+			return errors.New("bah")
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Stop:     stop,
+		Context:  context.Background(),
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(clock.delays, gc.HasLen, 3)
+}
+
+func (*retrySuite) TestContextDeadlineWithWallClock(c *gc.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 5,
+		Delay:    time.Hour,
+		Context:  ctx,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+	c.Assert(errors.Cause(err), gc.Equals, context.DeadlineExceeded)
+}
+
+func (*retrySuite) TestNotifyFunc(c *gc.C) {
+	var (
+		clock      = &mockClock{}
+		funcErr    = errors.New("bah")
+		attempts   []int
+		funcErrors []error
+	)
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			return funcErr
+		},
+		NotifyFunc: func(lastError error, attempt int) {
+			funcErrors = append(funcErrors, lastError)
+			attempts = append(attempts, attempt)
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, gc.HasLen, 2)
+	c.Assert(funcErrors, jc.DeepEquals, []error{funcErr, funcErr, funcErr})
+	c.Assert(attempts, jc.DeepEquals, []int{1, 2, 3})
+}
+
+func (s *retrySuite) TestNotifyFuncWithDelay(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.5 })
+	var (
+		clock    = &mockClock{}
+		attempts []int
+		delays   []time.Duration
+	)
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		NotifyFuncWithDelay: func(lastError error, attempt int, nextDelay time.Duration) {
+			attempts = append(attempts, attempt)
+			delays = append(delays, nextDelay)
+		},
+		Attempts:      4,
+		Delay:         time.Minute,
+		MaxDelay:      3 * time.Minute,
+		BackoffFactor: 2,
+		Jitter:        true,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(attempts, jc.DeepEquals, []int{1, 2, 3, 4})
+	// The delays are the ones actually waited for, and there is no delay
+	// after the final attempt.
+	c.Assert(delays[:3], jc.DeepEquals, clock.delays)
+	c.Assert(delays, jc.DeepEquals, []time.Duration{
+		45 * time.Second,
+		90 * time.Second,
+		135 * time.Second,
+		0,
+	})
+}
+
+func (*retrySuite) TestShouldRetry(c *gc.C) {
+	var (
+		clock    = &mockClock{}
+		funcErr  = errors.New("bah")
+		calls    []string
+		attempts []int
+	)
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return funcErr },
+		NotifyFunc: func(lastError error, attempt int) {
+			calls = append(calls, "notify")
+		},
+		ShouldRetry: func(err error, attempt int) bool {
+			calls = append(calls, "should-retry")
+			attempts = append(attempts, attempt)
+			return attempt < 2
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(errors.Cause(err).(*retry.RetryStopped).LastError, gc.Equals, funcErr)
+	c.Assert(errors.Cause(err).(*retry.RetryStopped).Errors, jc.DeepEquals, []error{funcErr, funcErr})
+	c.Assert(calls, jc.DeepEquals, []string{"notify", "should-retry", "notify", "should-retry"})
+	c.Assert(attempts, jc.DeepEquals, []int{1, 2})
+	c.Assert(clock.delays, gc.HasLen, 1)
+}
+
+func (*retrySuite) TestShouldRetryNotCalledForFatalOrFinalErrors(c *gc.C) {
+	called := false
+	shouldRetry := func(error, int) bool {
+		called = true
+		return true
+	}
+	err := retry.Call(retry.CallArgs{
+		Func:         func() error { return errors.New("bah") },
+		IsFatalError: func(error) bool { return true },
+		ShouldRetry:  shouldRetry,
+		Attempts:     5,
+		Delay:        time.Minute,
+		Clock:        &mockClock{},
+	})
+	c.Assert(err, gc.ErrorMatches, `bah`)
+	c.Assert(called, jc.IsFalse)
+
+	err = retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		ShouldRetry: shouldRetry,
+		Attempts:    1,
+		Delay:       time.Minute,
+		Clock:       &mockClock{},
+	})
+	c.Assert(err, gc.ErrorMatches, `bah`)
+	c.Assert(called, jc.IsFalse)
+}
+
+func (*retrySuite) TestSuccessFunc(c *gc.C) {
+	var (
+		clock    = &mockClock{}
+		count    = 0
+		attempts []int
+		totals   []time.Duration
+	)
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count < 3 {
+				return errors.New("bah")
+			}
+			return nil
+		},
+		SuccessFunc: func(attempt int, total time.Duration) {
+			attempts = append(attempts, attempt)
+			totals = append(totals, total)
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(attempts, jc.DeepEquals, []int{3})
+	c.Assert(totals, jc.DeepEquals, []time.Duration{2 * time.Minute})
+}
+
+func (*retrySuite) TestSuccessFuncNotCalledOnFailure(c *gc.C) {
+	called := false
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		SuccessFunc: func(int, time.Duration) { called = true },
+		Attempts:    3,
+		Delay:       time.Minute,
+		Clock:       &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(called, jc.IsFalse)
+}
+
+func (*retrySuite) TestInfiniteRetries(c *gc.C) {
+	// OK, we can't test infinite, but we'll go for lots.
+	clock := &mockClock{}
+	stop := make(chan struct{})
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			if count == 111 {
+				close(stop)
+			}
+			count++
+			return errors.New("bah")
+		},
+		Attempts: retry.UnlimitedAttempts,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Stop:     stop,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(clock.delays, gc.HasLen, count)
+}
+
+func (*retrySuite) TestBackoffDoesNotOverflow(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Attempts:      12,
+		Delay:         time.Hour,
+		BackoffFactor: 100,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, gc.HasLen, 11)
+	for i := 1; i < len(clock.delays); i++ {
+		c.Check(clock.delays[i] >= clock.delays[i-1], jc.IsTrue)
+	}
+	c.Assert(clock.delays[10], gc.Equals, time.Duration(math.MaxInt64))
+}
+
+func (*retrySuite) TestMaxDelay(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Attempts:      7,
+		Delay:         time.Minute,
+		MaxDelay:      10 * time.Minute,
+		BackoffFactor: 2,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		8 * time.Minute,
+		10 * time.Minute,
+		10 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestMaxDuration(c *gc.C) {
+	clock := &mockClock{}
+	funcErr := errors.New("bah")
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return funcErr },
+		Attempts:      retry.UnlimitedAttempts,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		MaxDuration:   10 * time.Minute,
+		Clock:         clock,
+	})
+	c.Assert(err, gc.ErrorMatches, `max duration exceeded: bah`)
+	cause := errors.Cause(err)
+	c.Assert(cause, jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(err, jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(cause.(*retry.DurationExceeded).LastError, gc.Equals, funcErr)
+	c.Assert(cause.(*retry.DurationExceeded).Errors, jc.DeepEquals, []error{funcErr, funcErr, funcErr, funcErr})
+	c.Assert(cause.(*retry.DurationExceeded).Elapsed, gc.Equals, 7*time.Minute)
+	// The next delay of 8 minutes would take the total past 10 minutes,
+	// so it isn't waited for.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestMaxDurationWithAttempts(c *gc.C) {
+	for i, test := range []struct {
+		attempts    int
+		maxDuration time.Duration
+		check       func(error) bool
+		delays      int
+	}{{
+		// The attempts run out first.
+		attempts:    3,
+		maxDuration: 10 * time.Minute,
+		check:       retry.IsAttemptsExceeded,
+		delays:      2,
+	}, {
+		// The duration runs out first.
+		attempts:    10,
+		maxDuration: 3 * time.Minute,
+		check:       retry.IsDurationExceeded,
+		delays:      3,
+	}, {
+		// Both run out after the fourth attempt, which is the final
+		// attempt so there is no delay to skip.
+		attempts:    4,
+		maxDuration: 3 * time.Minute,
+		check:       retry.IsAttemptsExceeded,
+		delays:      3,
+	}} {
+		c.Logf("test %d", i)
+		clock := &mockClock{}
+		err := retry.Call(retry.CallArgs{
+			Func:        func() error { return errors.New("bah") },
+			Attempts:    test.attempts,
+			Delay:       time.Minute,
+			MaxDuration: test.maxDuration,
+			Clock:       clock,
+		})
+		c.Check(errors.Cause(err), jc.Satisfies, test.check)
+		c.Check(clock.delays, gc.HasLen, test.delays)
+	}
+}
+
+func (*retrySuite) TestMaxDurationWithHugeDelay(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Attempts:      retry.UnlimitedAttempts,
+		Delay:         time.Hour,
+		BackoffFactor: 1e10,
+		MaxDuration:   24 * time.Hour,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Hour})
+}
+
+func (*retrySuite) TestMaxDurationIncludesFuncTime(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			clock.now = clock.now.Add(time.Minute)
+			return errors.New("bah")
+		},
+		Attempts:    retry.UnlimitedAttempts,
+		Delay:       time.Minute,
+		MaxDuration: 5 * time.Minute,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
+
+func (s *retrySuite) TestMinDelay(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.99 })
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Attempts:      4,
+		Delay:         time.Minute,
+		MinDelay:      70 * time.Second,
+		BackoffFactor: 2,
+		Jitter:        true,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The first delay is raised to the MinDelay before it is scaled, and
+	// jitter that would take a delay below the MinDelay is clamped.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		70 * time.Second,
+		70*time.Second + 700*time.Millisecond,
+		141*time.Second + 400*time.Millisecond,
+	})
+}
+
+func (*retrySuite) TestMinDelayGreaterThanMaxDelayNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 5,
+		Delay:    time.Minute,
+		MinDelay: 2 * time.Minute,
+		MaxDelay: time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `MinDelay of 2m0s greater than MaxDelay of 1m0s not valid`)
+}
+
+func (*retrySuite) TestWithWallClock(c *gc.C) {
+	var attempts []int
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		NotifyFunc: func(lastError error, attempt int) {
+			attempts = append(attempts, attempt)
+		},
+		Attempts: 5,
+		Delay:    time.Microsecond,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(attempts, jc.DeepEquals, []int{1, 2, 3, 4, 5})
+}
+
+func (*retrySuite) TestMissingFuncNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `missing Func, FuncWithAttempt or FuncCtx not valid`)
+}
+
+func (*retrySuite) TestMissingFuncAtCallTime(c *gc.C) {
+	// If the funcs are somehow all nil once the loop has started, the
+	// loop stops with the same error that Validate would give.
+	args := &retry.CallArgs{}
+	err := retry.CallFunc(args, context.Background(), 1)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `missing Func, FuncWithAttempt or FuncCtx not valid`)
+	cause, ok := retry.Aborted(err)
+	c.Check(ok, jc.IsTrue)
+	c.Check(cause, jc.Satisfies, errors.IsNotValid)
+}
+
+func (*retrySuite) TestFuncWithAttempt(c *gc.C) {
+	clock := &mockClock{}
+	var funcAttempts, notifyAttempts []int
+	err := retry.Call(retry.CallArgs{
+		FuncWithAttempt: func(attempt int) error {
+			funcAttempts = append(funcAttempts, attempt)
+			return errors.New("bah")
+		},
+		NotifyFunc: func(lastError error, attempt int) {
+			notifyAttempts = append(notifyAttempts, attempt)
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(funcAttempts, jc.DeepEquals, []int{1, 2, 3})
+	c.Assert(notifyAttempts, jc.DeepEquals, funcAttempts)
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
+
+func (*retrySuite) TestFuncAndFuncWithAttemptNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:            func() error { return errors.New("bah") },
+		FuncWithAttempt: func(int) error { return errors.New("bah") },
+		Attempts:        5,
+		Delay:           time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `setting both Func and FuncWithAttempt not valid`)
+}
+
+func (*retrySuite) TestFuncCtx(c *gc.C) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	clock := &mockClock{}
+	var values []interface{}
+	err := retry.Call(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			values = append(values, ctx.Value(key{}))
+			return errors.New("bah")
+		},
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    clock,
+		Context:  ctx,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(values, jc.DeepEquals, []interface{}{"value", "value"})
+}
+
+func (*retrySuite) TestFuncCtxWithoutContext(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			c.Check(ctx, gc.NotNil)
+			_, ok := ctx.Deadline()
+			c.Check(ok, jc.IsFalse)
+			return nil
+		},
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*retrySuite) TestFuncCtxAttemptTimeout(c *gc.C) {
+	ctxErrs := make(chan error, 2)
+	count, err := retry.CallCount(retry.CallArgs{
+		FuncCtx: func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			c.Check(ok, jc.IsTrue)
+			<-ctx.Done()
+			ctxErrs <- ctx.Err()
+			return ctx.Err()
+		},
+		Attempts:       2,
+		Delay:          time.Microsecond,
+		AttemptTimeout: 50 * time.Millisecond,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 2)
+	// Each attempt's context is done once the attempt is over, so FuncCtx
+	// doesn't carry on in the background.
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-ctxErrs:
+			c.Check(err, gc.NotNil)
+		case <-time.After(testing.LongWait):
+			c.Fatalf("attempt %d not cancelled", i+1)
+		}
+	}
+}
+
+func (*retrySuite) TestFuncAndFuncCtxNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		FuncCtx:  func(context.Context) error { return errors.New("bah") },
+		Attempts: 5,
+		Delay:    time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `setting both Func and FuncCtx not valid`)
+}
+
+func (*retrySuite) TestFuncWithAttemptAndFuncCtxNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		FuncWithAttempt: func(int) error { return errors.New("bah") },
+		FuncCtx:         func(context.Context) error { return errors.New("bah") },
+		Attempts:        5,
+		Delay:           time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `setting both FuncWithAttempt and FuncCtx not valid`)
+}
+
+func (*retrySuite) TestAllFuncsNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:            func() error { return errors.New("bah") },
+		FuncWithAttempt: func(int) error { return errors.New("bah") },
+		FuncCtx:         func(context.Context) error { return errors.New("bah") },
+		Attempts:        5,
+		Delay:           time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `setting all of Func, FuncWithAttempt, FuncCtx not valid`)
+}
+
+func (*retrySuite) TestConflictingFuncsCheckedFirst(c *gc.C) {
+	// The conflict is reported rather than the HedgeAfter that needs a
+	// FuncCtx alone.
+	err := retry.Call(retry.CallArgs{
+		Func:       func() error { return errors.New("bah") },
+		FuncCtx:    func(context.Context) error { return errors.New("bah") },
+		HedgeAfter: time.Second,
+		Attempts:   5,
+		Delay:      time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `setting both Func and FuncCtx not valid`)
+}
+
+func (*retrySuite) TestMissingAttemptsNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:  func() error { return errors.New("bah") },
+		Delay: time.Minute,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `missing Attempts not valid`)
+}
+
+func (*retrySuite) TestMissingDelayNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 5,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `missing Delay not valid`)
+}
+
+func (*retrySuite) TestBackoffErrors(c *gc.C) {
+	// Backoff values of less than one are a validation error.
+	for _, factor := range []float64{-2, 0.5} {
+		err := retry.Call(retry.CallArgs{
+			Func:          func() error { return errors.New("bah") },
+			Attempts:      5,
+			Delay:         time.Minute,
+			BackoffFactor: factor,
+		})
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, `BackoffFactor of .* not valid`)
+	}
+}
+
+func (*retrySuite) TestAllowDecay(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Attempts:      6,
+		Delay:         time.Minute,
+		BackoffFactor: 0.5,
+		AllowDecay:    true,
+		MinDelay:      10 * time.Second,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		30 * time.Second,
+		15 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+	})
+}
+
+func (*retrySuite) TestAllowDecayErrors(c *gc.C) {
+	for i, test := range []struct {
+		factor   float64
+		minDelay time.Duration
+		err      string
+	}{{
+		factor:   0.5,
+		minDelay: 0,
+		err:      `BackoffFactor of 0.5 without MinDelay not valid`,
+	}, {
+		factor:   -0.5,
+		minDelay: time.Second,
+		err:      `BackoffFactor of .* not valid`,
+	}} {
+		c.Logf("test %d", i)
+		err := retry.Call(retry.CallArgs{
+			Func:          func() error { return errors.New("bah") },
+			Attempts:      5,
+			Delay:         time.Minute,
+			BackoffFactor: test.factor,
+			AllowDecay:    true,
+			MinDelay:      test.minDelay,
+		})
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*retrySuite) TestNegativeDelayErrors(c *gc.C) {
+	for _, delay := range []time.Duration{-time.Minute, -1} {
+		err := retry.Call(retry.CallArgs{
+			Func:     func() error { return errors.New("bah") },
+			Attempts: 5,
+			Delay:    delay,
+		})
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, `Delay of .* not valid`)
+	}
+}
+
+func (*retrySuite) TestNegativeAttemptsErrors(c *gc.C) {
+	// UnlimitedAttempts is the only valid negative value.
+	for _, attempts := range []int{-2, -100} {
+		err := retry.Call(retry.CallArgs{
+			Func:     func() error { return errors.New("bah") },
+			Attempts: attempts,
+			Delay:    time.Minute,
+		})
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, `Attempts of .* not valid`)
+	}
+}
+
+func (*retrySuite) TestCallArgsDefaults(c *gc.C) {
+	// BackoffFactor is one of the two values with reasonable
+	// defaults, and the default is linear if not specified.
+	// The other default is the Clock. If not specified, it is the
+	// wall clock.
+	args := retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 5,
+		Delay:    time.Minute,
+	}
+
+	err := args.Validate()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(args.BackoffFactor, gc.Equals, float64(1))
+	c.Assert(args.Clock, gc.Equals, clock.WallClock)
+}
+
+func (*retrySuite) TestClone(c *gc.C) {
+	stop := make(chan struct{})
+	template := retry.CallArgs{
+		Attempts:      5,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		Stop:          stop,
+	}
+	clone := template.Clone()
+	clone.Func = func() error { return nil }
+	clone.Attempts = 3
+	clone.Delay = time.Second
+
+	c.Assert(template.Func, gc.IsNil)
+	c.Assert(template.Attempts, gc.Equals, 5)
+	c.Assert(template.Delay, gc.Equals, time.Minute)
+	c.Assert(clone.BackoffFactor, gc.Equals, float64(2))
+	c.Assert(clone.Stop, gc.Equals, template.Stop)
+	c.Assert(clone.Validate(), jc.ErrorIsNil)
+}
+
+func (*retrySuite) TestDelaySchedule(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:      6,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		MinDelay:      2 * time.Second,
+		MaxDelay:      10 * time.Second,
+	}
+	schedule := args.DelaySchedule()
+	c.Assert(schedule, jc.DeepEquals, []time.Duration{
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+	})
+
+	// The schedule matches the delays used by Call.
+	clock := &mockClock{}
+	args.Func = func() error { return errors.New("bah") }
+	args.Clock = clock
+	err := retry.Call(args)
+	c.Assert(retry.IsAttemptsExceeded(errors.Cause(err)), jc.IsTrue)
+	c.Assert(clock.delays, jc.DeepEquals, schedule)
+}
+
+func (*retrySuite) TestDelayScheduleDefaultBackoffFactor(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts: 3,
+		Delay:    time.Minute,
+	}
+	c.Assert(args.DelaySchedule(), jc.DeepEquals, []time.Duration{time.Minute, time.Minute})
+	c.Assert(args.BackoffFactor, gc.Equals, float64(0))
+}
+
+func (*retrySuite) TestDelayScheduleBackoffFunc(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts:    5,
+		Delay:       time.Second,
+		BackoffFunc: retry.FibonacciBackoff(time.Second),
+	}
+	c.Assert(args.DelaySchedule(), jc.DeepEquals, []time.Duration{
+		time.Second, time.Second, 2 * time.Second, 3 * time.Second,
+	})
+}
+
+func (s *retrySuite) TestDelayScheduleExcludesJitter(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 {
+		c.Fatalf("jitter applied")
+		return 0
+	})
+	args := retry.CallArgs{
+		Attempts:      3,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		Jitter:        true,
+	}
+	c.Assert(args.DelaySchedule(), jc.DeepEquals, []time.Duration{time.Second, 2 * time.Second})
+}
+
+func (*retrySuite) TestDelayScheduleUnlimitedAttempts(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts: retry.UnlimitedAttempts,
+		Delay:    time.Second,
+	}
+	c.Assert(args.DelaySchedule(), gc.IsNil)
+}
+
+func (*retrySuite) TestDelayScheduleSingleAttempt(c *gc.C) {
+	args := retry.CallArgs{
+		Attempts: 1,
+		Delay:    time.Second,
+	}
+	c.Assert(args.DelaySchedule(), gc.HasLen, 0)
+}
+
+func (s *retrySuite) TestZeroDelayYields(c *gc.C) {
+	yields := 0
+	s.PatchValue(retry.Yield, func() { yields++ })
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		Attempts:    5,
+		Delay:       time.Second,
+		BackoffFunc: func(time.Duration, int) time.Duration { return 0 },
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(yields, gc.Equals, 4)
+	c.Assert(clock.delays, gc.HasLen, 0)
+}
+
+func (*retrySuite) TestZeroDelayDoesNotStarveStop(c *gc.C) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	stop := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		<-started
+		close(stop)
+	}()
+	var once sync.Once
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			once.Do(func() { close(started) })
+			return errors.New("bah")
+		},
+		Attempts:    retry.UnlimitedAttempts,
+		Delay:       time.Second,
+		BackoffFunc: func(time.Duration, int) time.Duration { return 0 },
+		Clock:       &mockClock{},
+		Stop:        stop,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+}
+
+func (*retrySuite) TestMaxDelayLessThanDelay(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Minute,
+		MaxDelay: time.Second,
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute, time.Second})
+}
+
+func (*retrySuite) TestDeadlineMargin(c *gc.C) {
+	clock := &mockClock{now: time.Now()}
+	ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(10*time.Minute))
+	defer cancel()
+	err := retry.Call(retry.CallArgs{
+		Func:           func() error { return errors.New("bah") },
+		Attempts:       6,
+		Delay:          time.Minute,
+		BackoffFactor:  2,
+		Clock:          clock,
+		Context:        ctx,
+		DeadlineMargin: 30 * time.Second,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The fourth delay is shortened to leave 30s before the deadline, and
+	// after that there isn't enough time left to change the delay.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		150 * time.Second,
+		16 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestDeadlineMarginWithoutDeadline(c *gc.C) {
+	clock := &mockClock{now: time.Now()}
+	err := retry.Call(retry.CallArgs{
+		Func:           func() error { return errors.New("bah") },
+		Attempts:       3,
+		Delay:          time.Hour,
+		Clock:          clock,
+		Context:        context.Background(),
+		DeadlineMargin: 30 * time.Second,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Hour, time.Hour})
+}
+
+func (*retrySuite) TestErrorsIsAttemptsExceeded(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.Trace(io.EOF) },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(stderrors.Is(err, io.EOF), jc.IsTrue)
+	c.Assert(stderrors.Is(errors.Cause(err), io.EOF), jc.IsTrue)
+}
+
+func (*retrySuite) TestErrorsIsRetryStopped(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return io.EOF },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+		Stop:     stop,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(stderrors.Is(err, io.EOF), jc.IsTrue)
+}
+
+func (*retrySuite) TestErrorsIsDurationExceeded(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return io.EOF },
+		Attempts:    3,
+		Delay:       time.Minute,
+		MaxDuration: time.Second,
+		Clock:       &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(stderrors.Is(err, io.EOF), jc.IsTrue)
+	c.Assert(stderrors.Is(err, io.ErrUnexpectedEOF), jc.IsFalse)
+}
+
+func (*retrySuite) TestMaxConsecutiveSameError(c *gc.C) {
+	clock := &mockClock{}
+	errs := []error{io.ErrUnexpectedEOF, io.EOF, errors.Trace(io.EOF), io.EOF}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			err := errs[count]
+			count++
+			return err
+		},
+		Attempts:                10,
+		Delay:                   time.Minute,
+		Clock:                   clock,
+		MaxConsecutiveSameError: 3,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRepeatedError)
+	c.Assert(err, gc.ErrorMatches, `error repeated 3 times: EOF`)
+	c.Assert(count, gc.Equals, 4)
+	c.Assert(clock.delays, gc.HasLen, 3)
+	repeated := errors.Cause(err).(*retry.RepeatedError)
+	c.Assert(repeated.Count, gc.Equals, 3)
+	c.Assert(repeated.Errors, gc.HasLen, 4)
+}
+
+func (*retrySuite) TestMaxConsecutiveSameErrorReset(c *gc.C) {
+	errs := []error{io.EOF, io.EOF, io.ErrUnexpectedEOF, io.EOF, io.EOF}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			err := errs[count]
+			count++
+			return err
+		},
+		Attempts:                5,
+		Delay:                   time.Minute,
+		Clock:                   &mockClock{},
+		MaxConsecutiveSameError: 3,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+}
+
+func (*retrySuite) TestMaxConsecutiveSameErrorMessage(c *gc.C) {
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			// A new error each time, but with the same message.
+			return errors.New("bah")
+		},
+		Attempts:                5,
+		Delay:                   time.Minute,
+		Clock:                   &mockClock{},
+		MaxConsecutiveSameError: 3,
+	})
+	c.Assert(err, gc.ErrorMatches, `error repeated 3 times: bah`)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (*retrySuite) TestSameError(c *gc.C) {
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.Errorf("failure %d", count)
+		},
+		SameError: func(err, previous error) bool {
+			return true
+		},
+		Attempts:                5,
+		Delay:                   time.Minute,
+		Clock:                   &mockClock{},
+		MaxConsecutiveSameError: 2,
+	})
+	c.Assert(err, gc.ErrorMatches, `error repeated 2 times: failure 2`)
+}
+
+func (*retrySuite) TestNegativeMaxConsecutiveSameErrorNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:                    func() error { return nil },
+		Attempts:                5,
+		Delay:                   time.Minute,
+		MaxConsecutiveSameError: -1,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `MaxConsecutiveSameError of -1 not valid`)
+}
+
+func (*retrySuite) TestStartAttempt(c *gc.C) {
+	var calls []string
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			calls = append(calls, "func")
+			if count < 3 {
+				return errors.Errorf("failure %d", count)
+			}
+			return nil
+		},
+		StartAttempt: func(attempt int) func(error) {
+			calls = append(calls, fmt.Sprintf("start %d", attempt))
+			return func(err error) {
+				calls = append(calls, fmt.Sprintf("end %d: %v", attempt, err))
+			}
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(calls, jc.DeepEquals, []string{
+		"start 1", "func", "end 1: failure 1",
+		"start 2", "func", "end 2: failure 2",
+		"start 3", "func", "end 3: <nil>",
+	})
+}
+
+func (*retrySuite) TestStartAttemptNilEnd(c *gc.C) {
+	started := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		StartAttempt: func(attempt int) func(error) {
+			started++
+			return nil
+		},
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(started, gc.Equals, 2)
+}
+
+func (*retrySuite) TestStartAttemptPanic(c *gc.C) {
+	var endErr error
+	call := func() {
+		retry.Call(retry.CallArgs{
+			Func: func() error { panic("boom") },
+			StartAttempt: func(attempt int) func(error) {
+				return func(err error) { endErr = err }
+			},
+			Attempts: 2,
+			Delay:    time.Minute,
+			Clock:    &mockClock{},
+		})
+	}
+	c.Assert(call, gc.PanicMatches, "boom")
+	c.Assert(endErr, gc.ErrorMatches, "panic: boom")
+}
+
+func (*retrySuite) TestRecoverPanics(c *gc.C) {
+	var notified []error
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 1 {
+				panic("boom")
+			}
+			return nil
+		},
+		NotifyFunc: func(err error, attempt int) {
+			notified = append(notified, err)
+		},
+		Attempts:      3,
+		Delay:         time.Minute,
+		Clock:         &mockClock{},
+		RecoverPanics: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 2)
+	c.Assert(notified, gc.HasLen, 1)
+	c.Assert(notified[0], jc.Satisfies, retry.IsPanicError)
+	c.Assert(notified[0], gc.ErrorMatches, "panic: boom")
+	panicErr := notified[0].(*retry.PanicError)
+	c.Assert(panicErr.Value, gc.Equals, "boom")
+	c.Assert(string(panicErr.Stack), jc.Contains, "TestRecoverPanics")
+}
+
+func (*retrySuite) TestRecoverPanicsFatal(c *gc.C) {
+	var endErr error
+	err := retry.Call(retry.CallArgs{
+		Func:         func() error { panic("boom") },
+		IsFatalError: retry.IsPanicError,
+		StartAttempt: func(int) func(error) {
+			return func(err error) { endErr = err }
+		},
+		Attempts:      3,
+		Delay:         time.Minute,
+		Clock:         &mockClock{},
+		RecoverPanics: true,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsPanicError)
+	c.Assert(endErr, jc.Satisfies, retry.IsPanicError)
+}
+
+func (*retrySuite) TestMaxDelayFraction(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:             func() error { return errors.New("bah") },
+		Attempts:         5,
+		Delay:            time.Minute,
+		BackoffFactor:    2,
+		MaxDuration:      8 * time.Minute,
+		MaxDelayFraction: 0.5,
+		Clock:            clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// Each wait is at most half of the time left.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		150 * time.Second,
+		75 * time.Second,
+	})
+}
+
+func (*retrySuite) TestMaxDelayFractionWithMaxDelay(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:             func() error { return errors.New("bah") },
+		Attempts:         4,
+		Delay:            4 * time.Minute,
+		MaxDelay:         4 * time.Minute,
+		MaxDuration:      time.Hour,
+		MaxDelayFraction: 0.1,
+		Clock:            clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The MaxDelay is shorter until less than 40 minutes are left.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		4 * time.Minute,
+		4 * time.Minute,
+		4 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestMaxDelayFractionNotValid(c *gc.C) {
+	for i, test := range []struct {
+		fraction    float64
+		maxDuration time.Duration
+		err         string
+	}{{
+		fraction:    1.5,
+		maxDuration: time.Hour,
+		err:         `MaxDelayFraction of 1.5 not valid`,
+	}, {
+		fraction:    -0.5,
+		maxDuration: time.Hour,
+		err:         `MaxDelayFraction of -0.5 not valid`,
+	}, {
+		fraction: 0.5,
+		err:      `MaxDelayFraction without MaxDuration or Deadline not valid`,
+	}} {
+		c.Logf("test %d", i)
+		err := retry.Call(retry.CallArgs{
+			Func:             func() error { return nil },
+			Attempts:         3,
+			Delay:            time.Minute,
+			MaxDuration:      test.maxDuration,
+			MaxDelayFraction: test.fraction,
+		})
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*retrySuite) TestCanceller(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 2 {
+				cancel()
+			}
+			return errors.New("bah")
+		},
+		Attempts:  5,
+		Delay:     time.Minute,
+		Clock:     &mockClock{},
+		Canceller: ctx,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(count, gc.Equals, 2)
+}
+
+func (*retrySuite) TestCancellerAlreadyDone(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.New("bah")
+		},
+		Attempts:  5,
+		Delay:     time.Minute,
+		Clock:     &mockClock{},
+		Canceller: ctx,
+	})
+	// Like the Stop channel, the first attempt is still made.
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (*retrySuite) TestCancellerWithStop(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan struct{})
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 3 {
+				close(stop)
+			}
+			return errors.New("bah")
+		},
+		Attempts:  5,
+		Delay:     time.Minute,
+		Clock:     &sleeperClock{},
+		Stop:      stop,
+		Canceller: ctx,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (*retrySuite) TestCancellerNotSleeper(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := &sleeperClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:      func() error { return errors.New("bah") },
+		Attempts:  3,
+		Delay:     time.Minute,
+		Clock:     clock,
+		Canceller: ctx,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The Sleeper can't wait on the Canceller, so After is used.
+	c.Assert(clock.slept, gc.HasLen, 0)
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
+
+func (*retrySuite) TestBackoffForError(c *gc.C) {
+	clock := &mockClock{}
+	gentle := errors.New("gentle")
+	errs := []error{io.EOF, gentle, gentle, io.EOF, io.EOF}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			err := errs[count]
+			count++
+			return err
+		},
+		BackoffForError: func(err error) float64 {
+			if err == gentle {
+				return 1.5
+			}
+			return 0
+		},
+		Attempts:      5,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		Clock:         clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		90 * time.Second,
+		135 * time.Second,
+		270 * time.Second,
+	})
+}
+
+func (*retrySuite) TestBackoffForErrorWithBackoffFuncNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:            func() error { return nil },
+		Attempts:        3,
+		Delay:           time.Minute,
+		BackoffFunc:     retry.FibonacciBackoff(time.Second),
+		BackoffForError: func(error) float64 { return 2 },
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `setting both BackoffFunc and BackoffForError not valid`)
+}
+
+func (*retrySuite) TestSchedule(c *gc.C) {
+	clock := &mockClock{}
+	count, err := retry.CallCount(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Schedule: []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 5 * time.Minute},
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 5)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Second, 5 * time.Second, 30 * time.Second, 5 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestScheduleMoreAttempts(c *gc.C) {
+	clock := &mockClock{}
+	args := retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Schedule: []time.Duration{time.Second, time.Minute},
+		Attempts: 5,
+		MaxDelay: 30 * time.Second,
+		Clock:    clock,
+	}
+	err := retry.Call(args)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The last delay is repeated, and is limited by the MaxDelay.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Second, 30 * time.Second, 30 * time.Second, 30 * time.Second,
+	})
+	c.Assert(args.DelaySchedule(), jc.DeepEquals, clock.delays)
+}
+
+func (*retrySuite) TestScheduleDelaySchedule(c *gc.C) {
+	args := retry.CallArgs{
+		Schedule: []time.Duration{time.Second, time.Minute},
+	}
+	c.Assert(args.DelaySchedule(), jc.DeepEquals, []time.Duration{time.Second, time.Minute})
+}
+
+func (*retrySuite) TestScheduleNotValid(c *gc.C) {
+	for i, test := range []struct {
+		args retry.CallArgs
+		err  string
+	}{{
+		args: retry.CallArgs{Delay: time.Second},
+		err:  `setting both Schedule and Delay not valid`,
+	}, {
+		args: retry.CallArgs{BackoffFactor: 2},
+		err:  `setting both Schedule and BackoffFactor not valid`,
+	}, {
+		args: retry.CallArgs{BackoffFunc: retry.FibonacciBackoff(time.Second)},
+		err:  `setting both Schedule and BackoffFunc not valid`,
+	}, {
+		args: retry.CallArgs{BackoffForError: func(error) float64 { return 2 }},
+		err:  `setting both Schedule and BackoffForError not valid`,
+	}, {
+		args: retry.CallArgs{Schedule: []time.Duration{time.Second, -time.Second}},
+		err:  `Schedule delay of -1s not valid`,
+	}} {
+		c.Logf("test %d", i)
+		args := test.args
+		args.Func = func() error { return nil }
+		if args.Schedule == nil {
+			args.Schedule = []time.Duration{time.Second}
+		}
+		err := retry.Call(args)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*retrySuite) TestCloneSchedule(c *gc.C) {
+	template := retry.CallArgs{
+		Schedule: []time.Duration{time.Second, time.Minute},
+	}
+	clone := template.Clone()
+	clone.Schedule[0] = time.Hour
+	c.Assert(template.Schedule, jc.DeepEquals, []time.Duration{time.Second, time.Minute})
+}
+
+func (s *retrySuite) TestDefaultContext(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.PatchValue(&retry.DefaultContext, ctx)
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 2 {
+				cancel()
+			}
+			return errors.New("bah")
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+	c.Assert(count, gc.Equals, 2)
+}
+
+func (s *retrySuite) TestDefaultContextNotUsedWithStop(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.PatchValue(&retry.DefaultContext, ctx)
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+		Stop:     make(chan struct{}),
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+}
+
+func (*retrySuite) TestDefaultContextIsBackground(c *gc.C) {
+	c.Assert(retry.DefaultContext, gc.Equals, context.Background())
+}
+
+func (*retrySuite) TestSleep(c *gc.C) {
+	clock := &mockClock{}
+	interrupted := retry.Sleep(clock, time.Minute, nil)
+	c.Assert(interrupted, jc.IsFalse)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute})
+}
+
+func (*retrySuite) TestSleepStopped(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	interrupted := retry.Sleep(&mockClock{}, time.Minute, stop)
+	c.Assert(interrupted, jc.IsTrue)
+	interrupted = retry.Sleep(&mockClock{}, 0, stop)
+	c.Assert(interrupted, jc.IsTrue)
+}
+
+func (*retrySuite) TestSleepInterrupted(c *gc.C) {
+	stop := make(chan struct{})
+	go func() {
+		time.Sleep(time.Millisecond)
+		close(stop)
+	}()
+	interrupted := retry.Sleep(clock.WallClock, time.Hour, stop)
+	c.Assert(interrupted, jc.IsTrue)
+}
+
+func (s *retrySuite) TestSpreadFirstAttempt(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.25 })
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:               func() error { return errors.New("bah") },
+		Attempts:           2,
+		Delay:              time.Second,
+		InitialDelay:       time.Minute,
+		SpreadFirstAttempt: 4 * time.Minute,
+		Clock:              clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{2 * time.Minute, time.Second})
+}
+
+func (s *retrySuite) TestSpreadFirstAttemptStopped(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 { return 0.5 })
+	stop := make(chan struct{})
+	close(stop)
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			c.Fatalf("Func called")
+			return nil
+		},
+		Attempts:           2,
+		Delay:              time.Second,
+		SpreadFirstAttempt: time.Minute,
+		Clock:              &mockClock{},
+		Stop:               stop,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsNotAttempted)
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+}
+
+func (*retrySuite) TestNegativeSpreadFirstAttemptNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:               func() error { return nil },
+		Attempts:           2,
+		Delay:              time.Second,
+		SpreadFirstAttempt: -time.Second,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `SpreadFirstAttempt of -1s not valid`)
+}
+
+func (*retrySuite) TestDeadline(c *gc.C) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := &mockClock{now: now}
+	funcErr := errors.New("bah")
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return funcErr },
+		Attempts:      retry.UnlimitedAttempts,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		Deadline:      now.Add(10 * time.Minute),
+		Clock:         clock,
+	})
+	c.Assert(err, gc.ErrorMatches, `max duration exceeded: bah`)
+	cause := errors.Cause(err)
+	c.Assert(cause, jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(cause.(*retry.DurationExceeded).Elapsed, gc.Equals, 7*time.Minute)
+	c.Assert(cause.(*retry.DurationExceeded).Remaining, gc.Equals, 3*time.Minute)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+	})
+}
+
+func (*retrySuite) TestDeadlinePassed(c *gc.C) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := &mockClock{now: now}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.New("bah")
+		},
+		Attempts: 5,
+		Delay:    time.Minute,
+		Deadline: now.Add(-time.Minute),
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(errors.Cause(err).(*retry.DurationExceeded).Remaining, gc.Equals, -time.Minute)
+	// The first attempt is always made.
+	c.Assert(count, gc.Equals, 1)
+	c.Assert(clock.delays, gc.HasLen, 0)
+}
+
+func (*retrySuite) TestDeadlineWithMaxDuration(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return nil },
+		Attempts:    3,
+		Delay:       time.Minute,
+		MaxDuration: time.Hour,
+		Deadline:    time.Now().Add(time.Hour),
+		Clock:       &mockClock{},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `setting both MaxDuration and Deadline not valid`)
+}
+
+func (*retrySuite) TestMaxDurationRemaining(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return errors.New("bah") },
+		Attempts:    retry.UnlimitedAttempts,
+		Delay:       4 * time.Minute,
+		MaxDuration: 10 * time.Minute,
+		Clock:       &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsDurationExceeded)
+	c.Assert(errors.Cause(err).(*retry.DurationExceeded).Remaining, gc.Equals, 2*time.Minute)
+}
+
+func (*retrySuite) TestErrorFormatter(c *gc.C) {
+	funcErr := errors.New("bah")
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return funcErr },
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+		ErrorFormatter: func(lastError error, attempts int) string {
+			return fmt.Sprintf("gave up after %d attempts (%v)", attempts, lastError)
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, `gave up after 3 attempts \(bah\)`)
+	cause := errors.Cause(err)
+	c.Assert(cause, jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(cause.(*retry.AttemptsExceeded).LastError, gc.Equals, funcErr)
+	c.Assert(cause.(*retry.AttemptsExceeded).Attempts, gc.Equals, 3)
+}
+
+func (*retrySuite) TestErrorFormatterDefault(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: bah`)
+	c.Assert(errors.Cause(err).(*retry.AttemptsExceeded).Attempts, gc.Equals, 2)
+}
+
+func (*retrySuite) TestSingleAttemptReturnsError(c *gc.C) {
+	clock := &mockClock{}
+	funcErr := errors.New("bah")
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return funcErr
+		},
+		Attempts: 1,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(err, gc.ErrorMatches, `bah`)
+	c.Assert(errors.Cause(err), gc.Equals, funcErr)
+	c.Assert(errors.Cause(err), gc.Not(jc.Satisfies), retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 1)
+	c.Assert(clock.delays, gc.HasLen, 0)
+}
+
+func (*retrySuite) TestNotifyFuncV2(c *gc.C) {
+	type notification struct {
+		attempt   int
+		willRetry bool
+	}
+	for i, test := range []struct {
+		about  string
+		args   retry.CallArgs
+		expect []notification
+	}{{
+		about: "attempts exceeded",
+		args: retry.CallArgs{
+			Attempts: 3,
+		},
+		expect: []notification{{1, true}, {2, true}, {3, false}},
+	}, {
+		about: "fatal error",
+		args: retry.CallArgs{
+			Attempts: 5,
+			IsFatalErrorWithAttempt: func(_ error, attempt int) bool {
+				return attempt == 2
+			},
+		},
+		expect: []notification{{1, true}, {2, false}},
+	}, {
+		about: "not retryable",
+		args: retry.CallArgs{
+			Attempts:         5,
+			IsRetryableError: func(error) bool { return false },
+		},
+		expect: []notification{{1, false}},
+	}, {
+		about: "should not retry",
+		args: retry.CallArgs{
+			Attempts: 5,
+			ShouldRetry: func(_ error, attempt int) bool {
+				return attempt < 3
+			},
+		},
+		expect: []notification{{1, true}, {2, true}, {3, false}},
+	}, {
+		about: "max duration",
+		args: retry.CallArgs{
+			Attempts:    retry.UnlimitedAttempts,
+			MaxDuration: 150 * time.Second,
+		},
+		expect: []notification{{1, true}, {2, true}, {3, false}},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		var notifications []notification
+		args := test.args
+		args.Func = func() error { return errors.New("bah") }
+		args.Delay = time.Minute
+		args.Clock = &mockClock{}
+		args.NotifyFuncV2 = func(err error, attempt int, willRetry, _ bool) {
+			c.Check(err, gc.ErrorMatches, `bah`)
+			notifications = append(notifications, notification{attempt, willRetry})
+		}
+		err := retry.Call(args)
+		c.Check(err, gc.NotNil)
+		c.Check(notifications, jc.DeepEquals, test.expect)
+	}
+}
+
+func (*retrySuite) TestNotifyFuncV2SameAsPrevious(c *gc.C) {
+	timeout := errors.New("timeout")
+	refused := errors.New("refused")
+	results := []error{
+		timeout,
+		errors.Annotate(timeout, "getting"),
+		refused,
+		refused,
+		timeout,
+	}
+	count := 0
+	var same []bool
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			err := results[count]
+			count++
+			return err
+		},
+		NotifyFuncV2: func(_ error, _ int, _, sameAsPrevious bool) {
+			same = append(same, sameAsPrevious)
+		},
+		Attempts: len(results),
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(same, jc.DeepEquals, []bool{false, true, false, true, false})
+}
+
+func (*retrySuite) TestNotifyFuncV2SameAsPreviousUsesSameError(c *gc.C) {
+	count := 0
+	var same []bool
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.Errorf("failure %d", count)
+		},
+		SameError: func(err, previous error) bool {
+			return strings.HasPrefix(err.Error(), "failure")
+		},
+		NotifyFuncV2: func(_ error, _ int, _, sameAsPrevious bool) {
+			same = append(same, sameAsPrevious)
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(same, jc.DeepEquals, []bool{false, true, true})
+}
+
+func (s *retrySuite) TestMaxDelayedAttempts(c *gc.C) {
+	yields := 0
+	s.PatchValue(retry.Yield, func() { yields++ })
+	clock := &mockClock{}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.New("bah")
+		},
+		Attempts:           6,
+		Delay:              time.Second,
+		BackoffFactor:      2,
+		MinDelay:           time.Second,
+		MaxDelayedAttempts: 2,
+		Clock:              clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 6)
+	// After two delayed retries, the rest are made straight away, even
+	// with a MinDelay.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Second, 2 * time.Second})
+	c.Assert(yields, gc.Equals, 3)
+}
+
+func (*retrySuite) TestMaxDelayedAttemptsStop(c *gc.C) {
+	stop := make(chan struct{})
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 3 {
+				close(stop)
+			}
+			return errors.New("bah")
+		},
+		Attempts:           retry.UnlimitedAttempts,
+		Delay:              time.Second,
+		MaxDelayedAttempts: 1,
+		Stop:               stop,
+		Clock:              &mockClock{},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (*retrySuite) TestMaxDelayedAttemptsNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:               func() error { return nil },
+		Attempts:           3,
+		Delay:              time.Second,
+		MaxDelayedAttempts: -1,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `MaxDelayedAttempts of -1 not valid`)
+}
+
+// nilAfterClock is a broken clock whose After returns a nil channel.
+type nilAfterClock struct {
+	mockClock
+}
+
+func (*nilAfterClock) After(time.Duration) <-chan time.Time {
+	return nil
+}
+
+func (*retrySuite) TestClockAfterNil(c *gc.C) {
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.New("bah")
+		},
+		Attempts: 3,
+		Delay:    time.Second,
+		Clock:    &nilAfterClock{},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `Clock with After returning a nil channel not valid`)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (*retrySuite) TestClockAfterNilInitialDelay(c *gc.C) {
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return nil
+		},
+		Attempts:     3,
+		Delay:        time.Second,
+		InitialDelay: time.Second,
+		Clock:        &nilAfterClock{},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(count, gc.Equals, 0)
+}
+
+func (*retrySuite) TestSleepClockAfterNil(c *gc.C) {
+	c.Assert(retry.Sleep(&nilAfterClock{}, time.Second, nil), jc.IsFalse)
+}
+
+func (*retrySuite) TestJoinErrors(c *gc.C) {
+	first := errors.New("first")
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 1 {
+				return first
+			}
+			return errors.Errorf("attempt %d", count)
+		},
+		Attempts:   3,
+		Delay:      time.Minute,
+		Clock:      &mockClock{},
+		JoinErrors: true,
+	})
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded after 3 errors: attempt 3`)
+	cause := errors.Cause(err)
+	c.Assert(cause, jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(cause.(*retry.AttemptsExceeded).Errors, gc.HasLen, 3)
+	// Every error can be found, not just the last.
+	c.Assert(stderrors.Is(err, first), jc.IsTrue)
+	c.Assert(stderrors.Is(cause, first), jc.IsTrue)
+	var multi interface{ Unwrap() []error }
+	c.Assert(stderrors.As(cause, &multi), jc.IsTrue)
+	c.Assert(multi.Unwrap(), gc.HasLen, 3)
+}
+
+func (*retrySuite) TestJoinErrorsNotSet(c *gc.C) {
+	first := errors.New("first")
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 1 {
+				return first
+			}
+			return errors.New("bah")
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: bah`)
+	c.Assert(stderrors.Is(err, first), jc.IsFalse)
+}
+
+func (s *retrySuite) TestBackoffFactorJitter(c *gc.C) {
+	rands := []float64{0.5, 1, 0, 0.75}
+	s.PatchValue(retry.RandFloat64, func() float64 {
+		r := rands[0]
+		rands = rands[1:]
+		return r
+	})
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func:                func() error { return errors.New("bah") },
+		Attempts:            5,
+		Delay:               10 * time.Second,
+		BackoffFactor:       2,
+		BackoffFactorJitter: 0.1,
+		Clock:               clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The factors used are 2, 2.2, 1.8 and 2.1, compounding along the
+	// chain.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		10 * time.Second,
+		22 * time.Second,
+		39600 * time.Millisecond,
+		83160 * time.Millisecond,
+	})
+}
+
+func (*retrySuite) TestBackoffFactorJitterNotValid(c *gc.C) {
+	for _, jitter := range []float64{-0.1, 1, 1.5} {
+		err := retry.Call(retry.CallArgs{
+			Func:                func() error { return nil },
+			Attempts:            3,
+			Delay:               time.Second,
+			BackoffFactor:       2,
+			BackoffFactorJitter: jitter,
 		})
 		c.Check(err, jc.Satisfies, errors.IsNotValid)
-		c.Check(err, gc.ErrorMatches, `BackoffFactor of .* not valid`)
+		c.Check(err, gc.ErrorMatches, fmt.Sprintf(`BackoffFactorJitter of %v not valid`, jitter))
 	}
 }
 
-func (*retrySuite) TestCallArgsDefaults(c *gc.C) {
-	// BackoffFactor is one of the two values with reasonable
-	// defaults, and the default is linear if not specified.
-	// The other default is the Clock. If not specified, it is the
-	// wall clock.
-	args := retry.CallArgs{
-		Func:     func() error { return errors.New("bah") },
-		Attempts: 5,
-		Delay:    time.Minute,
+func (*retrySuite) TestMinInterval(c *gc.C) {
+	clock := &mockClock{}
+	funcTimes := []time.Duration{10 * time.Second, 40 * time.Second, 90 * time.Second, 0}
+	var starts []time.Time
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			starts = append(starts, clock.now)
+			clock.now = clock.now.Add(funcTimes[0])
+			funcTimes = funcTimes[1:]
+			return errors.New("bah")
+		},
+		Attempts:    4,
+		Delay:       5 * time.Second,
+		MinInterval: time.Minute,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The delay makes up the rest of the minute, unless Func has taken
+	// longer, when the Delay alone is used.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		50 * time.Second,
+		20 * time.Second,
+		5 * time.Second,
+	})
+	c.Assert(starts[1].Sub(starts[0]), gc.Equals, time.Minute)
+	c.Assert(starts[2].Sub(starts[1]), gc.Equals, time.Minute)
+	c.Assert(starts[3].Sub(starts[2]), gc.Equals, 95*time.Second)
+}
+
+func (s *retrySuite) TestMinIntervalWithoutDelay(c *gc.C) {
+	yields := 0
+	s.PatchValue(retry.Yield, func() { yields++ })
+	clock := &mockClock{}
+	slow := true
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			if slow {
+				clock.now = clock.now.Add(2 * time.Minute)
+			}
+			slow = !slow
+			return errors.New("bah")
+		},
+		Attempts:    3,
+		MinInterval: time.Minute,
+		Clock:       clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The slow attempt is followed straight away by the next one.
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute})
+	c.Assert(yields, gc.Equals, 1)
+}
+
+func (*retrySuite) TestMinIntervalNotValid(c *gc.C) {
+	err := retry.Call(retry.CallArgs{
+		Func:        func() error { return nil },
+		Attempts:    3,
+		Delay:       time.Second,
+		MinInterval: -time.Second,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `MinInterval of -1s not valid`)
+}
+
+func (*retrySuite) TestUnderlying(c *gc.C) {
+	funcErr := errors.New("bah")
+	for i, test := range []struct {
+		about string
+		args  retry.CallArgs
+	}{{
+		about: "attempts exceeded",
+		args: retry.CallArgs{
+			Attempts: 3,
+		},
+	}, {
+		about: "duration exceeded",
+		args: retry.CallArgs{
+			Attempts:    retry.UnlimitedAttempts,
+			MaxDuration: 90 * time.Second,
+		},
+	}, {
+		about: "repeated error",
+		args: retry.CallArgs{
+			Attempts:                5,
+			MaxConsecutiveSameError: 2,
+		},
+	}, {
+		about: "budget exhausted",
+		args: retry.CallArgs{
+			Attempts: 5,
+			Budget:   retry.NewBudget(0, 1),
+		},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		args := test.args
+		args.Func = func() error { return errors.Annotate(funcErr, "getting") }
+		args.Delay = time.Minute
+		args.Clock = &mockClock{}
+		err := retry.Call(args)
+		c.Check(retry.Underlying(err), gc.ErrorMatches, `getting: bah`)
+		c.Check(errors.Cause(retry.Underlying(err)), gc.Equals, funcErr)
 	}
+}
 
-	err := args.Validate()
-	c.Assert(err, jc.ErrorIsNil)
-	c.Assert(args.BackoffFactor, gc.Equals, float64(1))
-	c.Assert(args.Clock, gc.Equals, clock.WallClock)
+func (*retrySuite) TestUnderlyingRetryStopped(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 3,
+		Delay:    time.Hour,
+		Stop:     stop,
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(retry.Underlying(err), gc.ErrorMatches, `bah`)
+}
+
+func (*retrySuite) TestUnderlyingUnchanged(c *gc.C) {
+	c.Check(retry.Underlying(nil), jc.ErrorIsNil)
+	err := errors.New("bah")
+	c.Check(retry.Underlying(err), gc.Equals, err)
+	// A loop that was stopped before calling the function has no last error.
+	stopped := &retry.RetryStopped{}
+	c.Check(retry.Underlying(stopped), gc.Equals, stopped)
+}
+
+func (s *retrySuite) TestRand(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 {
+		c.Fatalf("global source used")
+		return 0
+	})
+	delays := func(seed int64) []time.Duration {
+		clock := &mockClock{}
+		err := retry.Call(retry.CallArgs{
+			Func:                func() error { return errors.New("bah") },
+			Attempts:            5,
+			Delay:               time.Second,
+			BackoffFactor:       2,
+			BackoffFactorJitter: 0.5,
+			Jitter:              true,
+			SpreadFirstAttempt:  time.Minute,
+			Rand:                rand.New(rand.NewSource(seed)),
+			Clock:               clock,
+		})
+		c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+		return clock.delays
+	}
+	first := delays(42)
+	c.Assert(first, gc.HasLen, 5)
+	// The same seed gives the same delays, including the spread of the
+	// first attempt.
+	c.Assert(delays(42), jc.DeepEquals, first)
+	c.Assert(delays(43), gc.Not(jc.DeepEquals), first)
 }
 
 func (*retrySuite) TestScaleDuration(c *gc.C) {
@@ -332,8 +3143,70 @@ func (*retrySuite) TestScaleDuration(c *gc.C) {
 		current: time.Minute,
 		scale:   -2,
 		expect:  2 * time.Minute,
+	}, {
+		// the largest duration is not an overflow
+		current: math.MaxInt64,
+		scale:   1,
+		expect:  math.MaxInt64,
+	}, {
+		// just below the largest duration
+		current: math.MaxInt64 / 2,
+		scale:   1.99,
+		expect:  time.Duration(float64(math.MaxInt64/2) * 1.99),
+	}, {
+		// overflows are capped at the largest duration
+		current: math.MaxInt64/2 + 1,
+		scale:   2,
+		expect:  math.MaxInt64,
+	}, {
+		current: 1000 * time.Hour,
+		scale:   1e10,
+		expect:  math.MaxInt64,
+	}, {
+		// overflows are capped at the max, if there is one
+		current: 1000 * time.Hour,
+		max:     time.Hour,
+		scale:   1e10,
+		expect:  time.Hour,
+	}, {
+		current: time.Minute,
+		scale:   math.Inf(1),
+		expect:  math.MaxInt64,
 	}} {
 		c.Logf("test %d", i)
 		c.Check(retry.ScaleDuration(test.current, test.max, test.scale), gc.Equals, test.expect)
 	}
 }
+
+func (*retrySuite) TestClampDuration(c *gc.C) {
+	for i, test := range []struct {
+		current time.Duration
+		min     time.Duration
+		max     time.Duration
+		expect  time.Duration
+	}{{
+		current: time.Minute,
+		expect:  time.Minute,
+	}, {
+		current: time.Minute,
+		min:     2 * time.Minute,
+		expect:  2 * time.Minute,
+	}, {
+		current: time.Minute,
+		max:     30 * time.Second,
+		expect:  30 * time.Second,
+	}, {
+		current: time.Minute,
+		min:     30 * time.Second,
+		max:     2 * time.Minute,
+		expect:  time.Minute,
+	}, {
+		current: 0,
+		min:     time.Second,
+		max:     time.Minute,
+		expect:  time.Second,
+	}} {
+		c.Logf("test %d", i)
+		c.Check(retry.ClampDuration(test.current, test.min, test.max), gc.Equals, test.expect)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	stderrors "errors"
+	"time"
+)
+
+// RetryAfter wraps the error returned from Func to ask Call to wait exactly
+// the delay before the next attempt, such as when a server has said when it
+// can next be tried. The delay is still capped by the MaxDelay, but the
+// MinDelay, jitter and DelayFunc are not applied to it. The backoff for
+// later attempts carries on as if the delay had not been overridden.
+//
+// The error returned has the same message as err, and err is its cause, so
+// passing it to IsFatalError or IsRetryableError predicates that look at the
+// cause behaves as if err had been returned directly. If err is nil,
+// RetryAfter returns nil.
+func RetryAfter(delay time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfter{err: err, delay: delay}
+}
+
+type retryAfter struct {
+	err   error
+	delay time.Duration
+}
+
+// Error provides the implementation for the error interface method.
+func (e *retryAfter) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the error that was wrapped.
+func (e *retryAfter) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the error that was wrapped.
+func (e *retryAfter) Unwrap() error {
+	return e.err
+}
+
+// retryAfterDelay returns the delay requested by RetryAfter, if the error
+// is, or wraps, an error returned from RetryAfter.
+func retryAfterDelay(err error) (time.Duration, bool) {
+	var after *retryAfter
+	if !stderrors.As(err, &after) {
+		return 0, false
+	}
+	return after.delay, true
+}
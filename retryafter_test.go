@@ -0,0 +1,128 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type retryAfterSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&retryAfterSuite{})
+
+func (*retryAfterSuite) TestError(c *gc.C) {
+	underlying := errors.New("busy")
+	err := retry.RetryAfter(time.Minute, underlying)
+	c.Assert(err, gc.ErrorMatches, "busy")
+	c.Assert(errors.Cause(err), gc.Equals, underlying)
+}
+
+func (*retryAfterSuite) TestOverridesDelay(c *gc.C) {
+	clock := &mockClock{}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 2 {
+				return retry.RetryAfter(time.Hour, errors.New("busy"))
+			}
+			return errors.New("bah")
+		},
+		Attempts:      4,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		MinDelay:      time.Second,
+		Clock:         clock,
+	})
+	c.Assert(retry.IsAttemptsExceeded(errors.Cause(err)), jc.IsTrue)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Second,
+		time.Hour,
+		4 * time.Second,
+	})
+}
+
+func (*retryAfterSuite) TestMaxDelay(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			return retry.RetryAfter(time.Hour, errors.New("busy"))
+		},
+		Attempts: 2,
+		Delay:    time.Second,
+		MaxDelay: time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(err, gc.ErrorMatches, "attempt count exceeded: busy")
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute})
+}
+
+func (*retryAfterSuite) TestTraced(c *gc.C) {
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			return errors.Trace(retry.RetryAfter(time.Minute, errors.New("busy")))
+		},
+		Attempts: 2,
+		Delay:    time.Second,
+		Clock:    clock,
+	})
+	c.Assert(retry.IsAttemptsExceeded(errors.Cause(err)), jc.IsTrue)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute})
+}
+
+func (s *retryAfterSuite) TestNoJitterOrDelayFunc(c *gc.C) {
+	s.PatchValue(retry.RandFloat64, func() float64 {
+		c.Fatalf("jitter applied")
+		return 0
+	})
+	clock := &mockClock{}
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			return retry.RetryAfter(time.Minute, errors.New("busy"))
+		},
+		DelayFunc: func(error, int, time.Duration) time.Duration {
+			c.Fatalf("DelayFunc called")
+			return 0
+		},
+		Attempts: 2,
+		Delay:    time.Second,
+		Jitter:   true,
+		Clock:    clock,
+	})
+	c.Assert(retry.IsAttemptsExceeded(errors.Cause(err)), jc.IsTrue)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{time.Minute})
+}
+
+func (*retryAfterSuite) TestIsFatalErrorSeesCause(c *gc.C) {
+	fatal := errors.New("fatal")
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return retry.RetryAfter(time.Minute, fatal)
+		},
+		IsFatalError: func(err error) bool {
+			return errors.Cause(err) == fatal
+		},
+		Attempts: 3,
+		Delay:    time.Second,
+		Clock:    &mockClock{},
+	})
+	c.Assert(errors.Cause(err), gc.Equals, fatal)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (*retryAfterSuite) TestRetryAfterNil(c *gc.C) {
+	c.Assert(retry.RetryAfter(time.Second, nil), jc.ErrorIsNil)
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+)
+
+// Retryer retries functions using a policy that is set up once, for when
+// only the function to call changes between calls. A Retryer is safe to use
+// from many goroutines at once, as long as anything shared by the CallArgs,
+// such as the Clock or Budget, is.
+type Retryer struct {
+	args CallArgs
+}
+
+// NewRetryer returns a Retryer that uses the CallArgs as its policy. The
+// CallArgs are validated as they would be by Call, except that none of
+// Func, FuncWithAttempt or FuncCtx may be set, as the function is given to
+// Run or RunCtx instead.
+func NewRetryer(args CallArgs) (*Retryer, error) {
+	if args.Func != nil || args.FuncWithAttempt != nil || args.FuncCtx != nil {
+		return nil, errors.NotValidf("Retryer with a Func")
+	}
+	check := args.Clone()
+	check.Func = func() error { return nil }
+	if _, err := check.validated(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	// The policy is kept as it was given, so that the defaults are applied
+	// afresh by each Run.
+	return &Retryer{args: args.Clone()}, nil
+}
+
+// Run calls f, retrying it according to the policy of the Retryer, and
+// returns the same error as Call would.
+func (r *Retryer) Run(f func() error) error {
+	args := r.args.Clone()
+	args.Func = f
+	return Call(args)
+}
+
+// RunCtx calls f as the FuncCtx, retrying it according to the policy of the
+// Retryer. The ctx is used as the Context instead of any Context in the
+// policy, so the retries stop when it is done.
+func (r *Retryer) RunCtx(ctx context.Context, f func(ctx context.Context) error) error {
+	args := r.args.Clone()
+	args.FuncCtx = f
+	args.Context = ctx
+	return Call(args)
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type retryerSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&retryerSuite{})
+
+func (*retryerSuite) TestRun(c *gc.C) {
+	clock := &mockClock{}
+	retryer, err := retry.NewRetryer(retry.CallArgs{
+		Attempts:      3,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		Clock:         clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	count := 0
+	err = retryer.Run(func() error {
+		count++
+		return errors.New("bah")
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 3)
+
+	count = 0
+	err = retryer.Run(func() error {
+		count++
+		if count < 2 {
+			return errors.New("bah")
+		}
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 2)
+	c.Assert(clock.delays, jc.DeepEquals, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		time.Second,
+	})
+}
+
+func (*retryerSuite) TestRunCtx(c *gc.C) {
+	retryer, err := retry.NewRetryer(retry.CallArgs{
+		Attempts: 3,
+		Delay:    time.Second,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err = retryer.RunCtx(ctx, func(ctx context.Context) error {
+		count++
+		cancel()
+		return errors.New("bah")
+	})
+	c.Assert(errors.Cause(err), gc.Equals, context.Canceled)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (*retryerSuite) TestNotValid(c *gc.C) {
+	_, err := retry.NewRetryer(retry.CallArgs{
+		Attempts: 3,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `missing Delay not valid`)
+
+	_, err = retry.NewRetryer(retry.CallArgs{
+		Func:     func() error { return nil },
+		Attempts: 3,
+		Delay:    time.Second,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `Retryer with a Func not valid`)
+}
+
+func (*retryerSuite) TestRunMissingFuncNotValid(c *gc.C) {
+	retryer, err := retry.NewRetryer(retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = retryer.Run(nil)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `missing Func, FuncWithAttempt or FuncCtx not valid`)
+}
@@ -0,0 +1,166 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// The retryhttp package retries HTTP requests using the retry package. It
+// is kept apart from the retry package so that using retry doesn't mean
+// depending on net/http.
+package retryhttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/retry"
+)
+
+// StatusError is the error used for an attempt that got a response with a
+// status code that is retried, that is any 5xx status or 429 Too Many
+// Requests. The body of the response has already been read and closed.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+// Error provides the implementation for the error interface method.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("response status %q", e.Status)
+}
+
+// StatusCode returns the status code of the response, so that the error
+// can be matched with retry.OnStatusCodes.
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// IsStatusError returns true if the error is, or was caused by, a
+// StatusError.
+func IsStatusError(err error) bool {
+	_, ok := errors.Cause(err).(*StatusError)
+	return ok
+}
+
+// DefaultPolicy is the policy that Do takes the Attempts, and the Delay with
+// its BackoffFactor and MaxDelay, from when they are not set.
+var DefaultPolicy = retry.Policy{
+	Attempts:      3,
+	Delay:         100 * time.Millisecond,
+	BackoffFactor: 2,
+	MaxDelay:      5 * time.Second,
+}
+
+// Do sends the request with the client, retrying it according to the
+// policy. If the client is nil, http.DefaultClient is used.
+//
+// The request is retried if the client returns an error, such as for a
+// network failure, or if the response has a status code of 429 Too Many
+// Requests or any 5xx status. If such a response has a Retry-After header,
+// either as a number of seconds or as an HTTP date, that is the delay
+// before the next attempt, still capped by the MaxDelay of the policy. Any
+// other response is returned as it is, whatever its status, and the caller
+// must close its body.
+//
+// The context of the request stops the retries once it is done. A request
+// with a body must have a GetBody, as set by http.NewRequest for the
+// common kinds of body, so that the body can be sent again each time.
+//
+// If the Attempts of the policy is zero, the Attempts of the DefaultPolicy
+// is used. If the Delay is zero, the Delay of the DefaultPolicy is used,
+// along with its BackoffFactor and MaxDelay if they are not set either, so
+// that the zero Policy retries as the DefaultPolicy does.
+//
+// If every attempt fails, the error is the same as retry.Call would return,
+// with the error from the client or a StatusError as the last error.
+func Do(client *http.Client, req *http.Request, policy retry.Policy) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return nil, errors.NotValidf("request with a body but no GetBody")
+	}
+	args := withDefaults(policy).ToCallArgs()
+	args.Context = req.Context()
+	attempt := 0
+	resp, err := retry.CallReturning(retry.CallArgsReturning[*http.Response]{
+		CallArgs: args,
+		Func: func() (*http.Response, error) {
+			attempt++
+			return send(client, req, attempt, time.Now())
+		},
+	})
+	return resp, errors.Trace(err)
+}
+
+// withDefaults returns the policy with the fields that are not set taken
+// from the DefaultPolicy, as described for Do.
+func withDefaults(policy retry.Policy) retry.Policy {
+	if policy.Attempts == 0 {
+		policy.Attempts = DefaultPolicy.Attempts
+	}
+	if policy.Delay == 0 {
+		policy.Delay = DefaultPolicy.Delay
+		if policy.BackoffFactor == 0 {
+			policy.BackoffFactor = DefaultPolicy.BackoffFactor
+		}
+		if policy.MaxDelay == 0 {
+			policy.MaxDelay = DefaultPolicy.MaxDelay
+		}
+	}
+	return policy
+}
+
+// send makes one attempt at the request, with a fresh copy of the body
+// for every attempt after the first.
+func send(client *http.Client, req *http.Request, attempt int, now time.Time) (*http.Response, error) {
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			// The request can't be sent again, so there's no point
+			// retrying.
+			return nil, retry.Abort(errors.Annotate(err, "rewinding request body"))
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return resp, nil
+	}
+	// Reading the rest of the body lets the connection be reused.
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	err = &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	if delay, ok := retryAfter(resp.Header.Get("Retry-After"), now); ok {
+		return nil, retry.RetryAfter(delay, err)
+	}
+	return nil, err
+}
+
+// retryAfter returns the delay from a Retry-After header, which is either
+// a number of seconds or an HTTP date. A date in the past is no delay.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	when, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if delay := when.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
@@ -0,0 +1,200 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retryhttp_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+	"github.com/juju/retry/retryhttp"
+)
+
+type doSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&doSuite{})
+
+var policy = retry.Policy{
+	Attempts: 3,
+	Delay:    time.Millisecond,
+	MaxDelay: 10 * time.Millisecond,
+}
+
+// server responds to each request with the next of the statuses, and
+// records the bodies of the requests.
+type server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header
+	bodies   []string
+}
+
+func newServer(header http.Header, statuses ...int) *server {
+	s := &server{statuses: statuses, header: header}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.bodies = append(s.bodies, string(body))
+	status := s.statuses[0]
+	s.statuses = s.statuses[1:]
+	s.mu.Unlock()
+	for key, values := range s.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, "response")
+}
+
+func (s *server) requestBodies() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies
+}
+
+func (*doSuite) TestRetriesServerErrors(c *gc.C) {
+	srv := newServer(nil, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	defer srv.Close()
+	req, err := http.NewRequest("POST", srv.URL, strings.NewReader("request"))
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := retryhttp.Do(nil, req, policy)
+	c.Assert(err, jc.ErrorIsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	body, err := io.ReadAll(resp.Body)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(body), gc.Equals, "response")
+	// The body is sent again for each attempt.
+	c.Assert(srv.requestBodies(), jc.DeepEquals, []string{"request", "request", "request"})
+}
+
+func (s *doSuite) TestDefaultPolicy(c *gc.C) {
+	s.PatchValue(&retryhttp.DefaultPolicy, retry.Policy{
+		Attempts: 2,
+		Delay:    time.Millisecond,
+	})
+	srv := newServer(nil, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer srv.Close()
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = retryhttp.Do(nil, req, retry.Policy{})
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: response status "503 Service Unavailable"`)
+	c.Assert(srv.requestBodies(), gc.HasLen, 2)
+}
+
+func (*doSuite) TestWithDefaults(c *gc.C) {
+	c.Assert(retryhttp.WithDefaults(retry.Policy{}), jc.DeepEquals, retryhttp.DefaultPolicy)
+	// A Delay that is set keeps its own backoff.
+	c.Assert(retryhttp.WithDefaults(retry.Policy{Delay: time.Second}), jc.DeepEquals, retry.Policy{
+		Attempts: retryhttp.DefaultPolicy.Attempts,
+		Delay:    time.Second,
+	})
+	c.Assert(retryhttp.WithDefaults(retry.Policy{Attempts: 5, BackoffFactor: 3}), jc.DeepEquals, retry.Policy{
+		Attempts:      5,
+		Delay:         retryhttp.DefaultPolicy.Delay,
+		BackoffFactor: 3,
+		MaxDelay:      retryhttp.DefaultPolicy.MaxDelay,
+	})
+	c.Assert(retryhttp.WithDefaults(policy), jc.DeepEquals, policy)
+}
+
+func (*doSuite) TestOtherStatusNotRetried(c *gc.C) {
+	srv := newServer(nil, http.StatusNotFound)
+	defer srv.Close()
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := retryhttp.Do(srv.Client(), req, policy)
+	c.Assert(err, jc.ErrorIsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNotFound)
+	c.Assert(srv.requestBodies(), gc.HasLen, 1)
+}
+
+func (*doSuite) TestAttemptsExceeded(c *gc.C) {
+	srv := newServer(http.Header{"Retry-After": {"120"}},
+		http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	defer srv.Close()
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	start := time.Now()
+	resp, err := retryhttp.Do(srv.Client(), req, policy)
+	c.Assert(resp, gc.IsNil)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: response status "502 Bad Gateway"`)
+	lastError := retry.Underlying(err)
+	c.Assert(lastError, jc.Satisfies, retryhttp.IsStatusError)
+	c.Assert(retry.OnStatusCodes(http.StatusBadGateway)(lastError), jc.IsTrue)
+	// The Retry-After is capped by the MaxDelay.
+	c.Assert(time.Since(start) < testing.LongWait, jc.IsTrue)
+}
+
+func (*doSuite) TestNetworkErrorRetried(c *gc.C) {
+	srv := newServer(nil)
+	url := srv.URL
+	srv.Close()
+	req, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = retryhttp.Do(nil, req, policy)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(errors.Cause(err).(*retry.AttemptsExceeded).Errors, gc.HasLen, 3)
+}
+
+func (*doSuite) TestContextCancelled(c *gc.C) {
+	srv := newServer(nil, http.StatusServiceUnavailable)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = retryhttp.Do(nil, req, policy)
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+	c.Assert(srv.requestBodies(), gc.HasLen, 0)
+}
+
+func (*doSuite) TestBodyWithoutGetBodyNotValid(c *gc.C) {
+	req, err := http.NewRequest("POST", "http://example.com", io.NopCloser(strings.NewReader("request")))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = retryhttp.Do(nil, req, policy)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `request with a body but no GetBody not valid`)
+}
+
+func (*doSuite) TestRetryAfter(c *gc.C) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	for i, test := range []struct {
+		header string
+		delay  time.Duration
+		ok     bool
+	}{
+		{header: "", ok: false},
+		{header: "bah", ok: false},
+		{header: "-1", ok: false},
+		{header: "0", delay: 0, ok: true},
+		{header: "120", delay: 2 * time.Minute, ok: true},
+		{header: "Wed, 21 Oct 2015 07:30:00 GMT", delay: 2 * time.Minute, ok: true},
+		{header: "Wed, 21 Oct 2015 07:00:00 GMT", delay: 0, ok: true},
+	} {
+		c.Logf("test %d: %q", i, test.header)
+		delay, ok := retryhttp.RetryAfter(test.header, now)
+		c.Check(ok, gc.Equals, test.ok)
+		c.Check(delay, gc.Equals, test.delay)
+	}
+}
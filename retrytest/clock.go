@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// The retrytest package provides helpers for testing code that uses the
+// retry package.
+package retrytest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Clock is a clock for use as the Clock of retry.CallArgs in tests. Time
+// only moves forward when the clock is advanced, and the channel returned
+// from After only receives once the clock has been advanced past the delay,
+// so the exact delays used by a retry loop can be checked without any real
+// waiting.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	delays  []time.Duration
+	waiting []waiter
+	// added is closed, and replaced, whenever a waiter is added.
+	added chan struct{}
+}
+
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewClock returns a Clock with the time set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{
+		now:   now,
+		added: make(chan struct{}),
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After records the delay, and returns a channel that receives the time
+// once the clock has been advanced by at least the delay. If the delay is
+// not positive, the channel receives straight away.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delays = append(c.delays, d)
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiting = append(c.waiting, waiter{
+		deadline: c.now.Add(d),
+		ch:       ch,
+	})
+	close(c.added)
+	c.added = make(chan struct{})
+	return ch
+}
+
+// Advance moves the clock forward by the duration, and triggers any waits
+// that are over.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiting[:0]
+	for _, w := range c.waiting {
+		if w.deadline.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiting = waiting
+}
+
+// WaitAdvance waits, for up to the timeout in real time, until there are at
+// least n waits in progress, and then advances the clock by the duration.
+// This is useful when the retry loop is running in another goroutine, to
+// make sure that it has started waiting before the clock is moved.
+func (c *Clock) WaitAdvance(d, timeout time.Duration, n int) error {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		count := len(c.waiting)
+		added := c.added
+		c.mu.Unlock()
+		if count >= n {
+			c.Advance(d)
+			return nil
+		}
+		select {
+		case <-added:
+		case <-deadline:
+			return errors.Errorf("got %d waits after %v, wanted %d", count, timeout, n)
+		}
+	}
+}
+
+// Delays returns every delay that has been passed to After, in order.
+func (c *Clock) Delays() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.delays...)
+}
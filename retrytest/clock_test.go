@@ -0,0 +1,96 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retrytest_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/clock"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+	"github.com/juju/retry/retrytest"
+)
+
+type clockSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&clockSuite{})
+
+var _ clock.Clock = (*retrytest.Clock)(nil)
+
+var epoch = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (*clockSuite) TestNow(c *gc.C) {
+	cl := retrytest.NewClock(epoch)
+	c.Assert(cl.Now(), gc.Equals, epoch)
+	cl.Advance(time.Minute)
+	c.Assert(cl.Now(), gc.Equals, epoch.Add(time.Minute))
+}
+
+func (*clockSuite) TestAfter(c *gc.C) {
+	cl := retrytest.NewClock(epoch)
+	ch := cl.After(time.Minute)
+	cl.Advance(59 * time.Second)
+	select {
+	case <-ch:
+		c.Fatalf("wait over too soon")
+	default:
+	}
+	cl.Advance(time.Second)
+	select {
+	case t := <-ch:
+		c.Assert(t, gc.Equals, epoch.Add(time.Minute))
+	default:
+		c.Fatalf("wait not over")
+	}
+	c.Assert(cl.Delays(), jc.DeepEquals, []time.Duration{time.Minute})
+}
+
+func (*clockSuite) TestAfterZero(c *gc.C) {
+	cl := retrytest.NewClock(epoch)
+	select {
+	case <-cl.After(0):
+	default:
+		c.Fatalf("wait not over")
+	}
+}
+
+func (*clockSuite) TestWaitAdvanceTimeout(c *gc.C) {
+	cl := retrytest.NewClock(epoch)
+	err := cl.WaitAdvance(time.Minute, time.Millisecond, 1)
+	c.Assert(err, gc.ErrorMatches, `got 0 waits after 1ms, wanted 1`)
+	c.Assert(cl.Now(), gc.Equals, epoch)
+}
+
+func (*clockSuite) TestCall(c *gc.C) {
+	cl := retrytest.NewClock(epoch)
+	done := make(chan error, 1)
+	go func() {
+		done <- retry.Call(retry.CallArgs{
+			Func:          func() error { return errors.New("bah") },
+			Attempts:      4,
+			Delay:         time.Second,
+			BackoffFactor: 2,
+			Clock:         cl,
+		})
+	}()
+	for _, d := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		err := cl.WaitAdvance(d, testing.LongWait, 1)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	select {
+	case err := <-done:
+		c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("Call did not return")
+	}
+	c.Assert(cl.Delays(), jc.DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second,
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// CallArgsReturning is used to define the behaviour of the CallReturning
+// function. All the retry behaviour is defined by the embedded CallArgs,
+// except that the Func, FuncWithAttempt and FuncCtx fields of the CallArgs
+// are ignored in favour of the Func that also returns a value.
+type CallArgsReturning[T any] struct {
+	CallArgs
+
+	// Func is the function that will be retried if it returns an error
+	// result. The value returned with a nil error is returned from
+	// CallReturning.
+	Func func() (T, error)
+
+	// RetryIfResult, if set, is called with the value returned by each call
+	// to Func that returns a nil error. If it returns true, the result is
+	// not ready yet, and the attempt is retried as if Func had returned
+	// ErrConditionNotMet. ErrConditionNotMet is never treated as fatal by
+	// the IsFatalError or IsRetryableError.
+	RetryIfResult func(T) bool
+}
+
+// CallReturning will repeatedly execute the Func until either the function
+// returns no error, the retry count is exceeded or the stop channel is
+// closed. The value returned by the successful call to Func is returned.
+// If Func never succeeds, the zero value of T is returned along with the
+// same error that Call would return, unless the last attempt returned a
+// value that RetryIfResult rejected, in which case that value is returned
+// with the error.
+//
+// If the loop is stopped by the Stop channel, Canceller or Context, the
+// value returned by the most recent call to Func is returned with the
+// error, even though Func also returned an error, so that a Func can
+// report the progress it made before being stopped. The zero value is
+// returned if Func has not returned at all.
+func CallReturning[T any](args CallArgsReturning[T]) (T, error) {
+	if args.Func == nil {
+		// The Func of the CallArgs is ignored, so only this Func can be
+		// missing.
+		var zero T
+		return zero, errors.NotValidf("missing Func")
+	}
+	// The results are recorded by attempt, as an attempt that has timed out
+	// may still succeed after a later attempt has.
+	var (
+		mu      sync.Mutex
+		results = make(map[int]T)
+		// rejected holds the values that RetryIfResult rejected.
+		rejected = make(map[int]T)
+		// progress is the value from the latest attempt to have returned,
+		// whether or not it failed.
+		progress        T
+		progressAttempt int
+	)
+	callArgs := args.CallArgs
+	callArgs.Func = nil
+	callArgs.FuncCtx = nil
+	callArgs.FuncWithAttempt = func(attempt int) error {
+		value, err := args.Func()
+		notReady := err == nil && args.RetryIfResult != nil && args.RetryIfResult(value)
+		mu.Lock()
+		defer mu.Unlock()
+		if attempt >= progressAttempt {
+			progress, progressAttempt = value, attempt
+		}
+		if err != nil {
+			return err
+		}
+		if notReady {
+			rejected[attempt] = value
+			return ErrConditionNotMet
+		}
+		results[attempt] = value
+		return nil
+	}
+	if args.RetryIfResult != nil {
+		callArgs.retryConditionNotMet()
+	}
+	attempt, err := CallCount(callArgs)
+	if err != nil {
+		mu.Lock()
+		defer mu.Unlock()
+		if IsRetryStopped(err) || IsRetryCancelled(err) {
+			return progress, errors.Trace(err)
+		}
+		return rejected[attempt], errors.Trace(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return results[attempt], nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type returningSuite struct {
+	testing.LoggingSuite
+}
+
+var _ = gc.Suite(&returningSuite{})
+
+func (*returningSuite) TestSuccessReturnsValue(c *gc.C) {
+	clock := &mockClock{}
+	count := 0
+	value, err := retry.CallReturning(retry.CallArgsReturning[string]{
+		Func: func() (string, error) {
+			count++
+			if count < 3 {
+				return "partial", errors.New("bah")
+			}
+			return "done", nil
+		},
+		CallArgs: retry.CallArgs{
+			Attempts: 5,
+			Delay:    time.Minute,
+			Clock:    clock,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(value, gc.Equals, "done")
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
+
+func (*returningSuite) TestAttemptsExceededReturnsZero(c *gc.C) {
+	clock := &mockClock{}
+	funcErr := errors.New("bah")
+	value, err := retry.CallReturning(retry.CallArgsReturning[int]{
+		Func: func() (int, error) { return 42, funcErr },
+		CallArgs: retry.CallArgs{
+			Attempts: 3,
+			Delay:    time.Minute,
+			Clock:    clock,
+		},
+	})
+	c.Assert(value, gc.Equals, 0)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: bah`)
+	cause := errors.Cause(err)
+	c.Assert(cause, jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(cause.(*retry.AttemptsExceeded).LastError, gc.Equals, funcErr)
+}
+
+func (*returningSuite) TestMissingFuncNotValid(c *gc.C) {
+	_, err := retry.CallReturning(retry.CallArgsReturning[int]{
+		CallArgs: retry.CallArgs{
+			Func:     func() error { return nil },
+			Attempts: 5,
+			Delay:    time.Minute,
+		},
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, `missing Func not valid`)
+}
+
+func (*returningSuite) TestNotAttempted(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := retry.CallReturning(retry.CallArgsReturning[int]{
+		Func: func() (int, error) { return 42, nil },
+		CallArgs: retry.CallArgs{
+			Attempts: 5,
+			Delay:    time.Minute,
+			Context:  ctx,
+		},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsNotAttempted)
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+}
+
+func (*returningSuite) TestRetryIfResult(c *gc.C) {
+	clock := &mockClock{}
+	count := 0
+	value, err := retry.CallReturning(retry.CallArgsReturning[string]{
+		Func: func() (string, error) {
+			count++
+			if count < 3 {
+				return "processing", nil
+			}
+			return "done", nil
+		},
+		RetryIfResult: func(value string) bool {
+			return value == "processing"
+		},
+		CallArgs: retry.CallArgs{
+			Attempts: 5,
+			Delay:    time.Minute,
+			Clock:    clock,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(value, gc.Equals, "done")
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
+
+func (*returningSuite) TestRetryIfResultAttemptsExceeded(c *gc.C) {
+	count := 0
+	value, err := retry.CallReturning(retry.CallArgsReturning[int]{
+		Func: func() (int, error) {
+			count++
+			return count, nil
+		},
+		RetryIfResult: func(int) bool { return true },
+		CallArgs: retry.CallArgs{
+			// A condition that is not met is retried even though
+			// every error is fatal.
+			IsFatalError: func(error) bool { return true },
+			Attempts:     3,
+			Delay:        time.Minute,
+			Clock:        &mockClock{},
+		},
+	})
+	// The last result is returned with the error.
+	c.Assert(value, gc.Equals, 3)
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: condition not met`)
+}
+
+func (*returningSuite) TestRetryIfResultLastAttemptFailed(c *gc.C) {
+	count := 0
+	value, err := retry.CallReturning(retry.CallArgsReturning[int]{
+		Func: func() (int, error) {
+			count++
+			if count == 3 {
+				return 0, errors.New("bah")
+			}
+			return count, nil
+		},
+		RetryIfResult: func(int) bool { return true },
+		CallArgs: retry.CallArgs{
+			Attempts: 3,
+			Delay:    time.Minute,
+			Clock:    &mockClock{},
+		},
+	})
+	c.Assert(value, gc.Equals, 0)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: bah`)
+}
+
+func (*returningSuite) TestStoppedReturnsProgress(c *gc.C) {
+	stop := make(chan struct{})
+	synced := 0
+	value, err := retry.CallReturning(retry.CallArgsReturning[int]{
+		Func: func() (int, error) {
+			synced += 10
+			if synced == 30 {
+				close(stop)
+			}
+			return synced, errors.New("bah")
+		},
+		CallArgs: retry.CallArgs{
+			Attempts: 5,
+			Delay:    time.Minute,
+			Stop:     stop,
+			Clock:    &mockClock{},
+		},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	// The progress from the last call is returned, although it failed.
+	c.Assert(value, gc.Equals, 30)
+}
+
+func (*returningSuite) TestCancelledReturnsProgress(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	value, err := retry.CallReturning(retry.CallArgsReturning[string]{
+		Func: func() (string, error) {
+			cancel()
+			return "processing", nil
+		},
+		RetryIfResult: func(value string) bool { return value == "processing" },
+		CallArgs: retry.CallArgs{
+			Attempts: 5,
+			Delay:    time.Minute,
+			Context:  ctx,
+			Clock:    &mockClock{},
+		},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+	c.Assert(value, gc.Equals, "processing")
+}
+
+func (*returningSuite) TestStoppedBeforeAttemptReturnsZero(c *gc.C) {
+	stop := make(chan struct{})
+	close(stop)
+	called := false
+	value, err := retry.CallReturning(retry.CallArgsReturning[int]{
+		Func: func() (int, error) {
+			called = true
+			return 42, nil
+		},
+		CallArgs: retry.CallArgs{
+			Attempts:     5,
+			Delay:        time.Minute,
+			InitialDelay: time.Minute,
+			Stop:         stop,
+			Clock:        &mockClock{},
+		},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsNotAttempted)
+	c.Assert(called, jc.IsFalse)
+	c.Assert(value, gc.Equals, 0)
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build go1.21
+// +build go1.21
+
+package retry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// slogLogger is the type of the Logger in the CallArgs.
+type slogLogger = *slog.Logger
+
+// Logger sets the Logger of the CallArgs.
+func (b *Builder) Logger(logger *slog.Logger) *Builder {
+	b.args.Logger = logger
+	return b
+}
+
+// logContext returns the context to log with, which is the Context of the
+// CallArgs if it is set, so that a handler can use the values in it.
+func (args *CallArgs) logContext() context.Context {
+	if args.Context != nil {
+		return args.Context
+	}
+	return context.Background()
+}
+
+// logAttempt logs a failed attempt that is allowed to be retried, with the
+// delay before the next attempt, which is zero if there won't be one.
+func (args *CallArgs) logAttempt(err error, attempt int, nextDelay time.Duration) {
+	if args.Logger == nil {
+		return
+	}
+	args.Logger.LogAttrs(args.logContext(), slog.LevelWarn, "retry attempt failed",
+		slog.Int("attempt", attempt),
+		slog.String("error", err.Error()),
+		slog.Duration("next_delay", nextDelay),
+	)
+}
+
+// logMaxDelay warns that the MaxDelay is less than the Delay, so only the
+// first delay is the Delay.
+func (args *CallArgs) logMaxDelay() {
+	if args.Logger == nil {
+		return
+	}
+	args.Logger.LogAttrs(args.logContext(), slog.LevelWarn, "retry MaxDelay less than Delay",
+		slog.Duration("max_delay", args.MaxDelay),
+		slog.Duration("delay", args.Delay),
+	)
+}
+
+// logOutcome logs the result of the retry loop.
+func (args *CallArgs) logOutcome(attempts int, err error) {
+	if args.Logger == nil {
+		return
+	}
+	if err == nil {
+		args.Logger.LogAttrs(args.logContext(), slog.LevelInfo, "retry succeeded",
+			slog.Int("attempts", attempts),
+		)
+		return
+	}
+	args.Logger.LogAttrs(args.logContext(), slog.LevelError, "retry failed",
+		slog.Int("attempts", attempts),
+		slog.String("error", err.Error()),
+	)
+}
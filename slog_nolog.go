@@ -0,0 +1,21 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !go1.21
+// +build !go1.21
+
+package retry
+
+import (
+	"time"
+)
+
+// slogLogger is the type of the Logger in the CallArgs. Before Go 1.21 there
+// is no log/slog package, so a Logger can never be set.
+type slogLogger = *struct{}
+
+func (args *CallArgs) logAttempt(err error, attempt int, nextDelay time.Duration) {}
+
+func (args *CallArgs) logMaxDelay() {}
+
+func (args *CallArgs) logOutcome(attempts int, err error) {}
@@ -0,0 +1,163 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build go1.21
+// +build go1.21
+
+package retry_test
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type slogSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&slogSuite{})
+
+// recordingHandler is a slog.Handler that records the level, message and
+// attributes of each record, and the context it was logged with.
+type recordingHandler struct {
+	records  []string
+	contexts []context.Context
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordingHandler) Handle(ctx context.Context, r slog.Record) error {
+	record := r.Level.String() + " " + r.Message
+	r.Attrs(func(attr slog.Attr) bool {
+		record += " " + attr.String()
+		return true
+	})
+	h.records = append(h.records, record)
+	h.contexts = append(h.contexts, ctx)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *recordingHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (*slogSuite) TestLogsFailure(c *gc.C) {
+	handler := &recordingHandler{}
+	err := retry.Call(retry.CallArgs{
+		Func:          func() error { return errors.New("bah") },
+		Attempts:      3,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		Clock:         &mockClock{},
+		Logger:        slog.New(handler),
+	})
+	c.Assert(retry.IsAttemptsExceeded(errors.Cause(err)), jc.IsTrue)
+	c.Assert(handler.records, jc.DeepEquals, []string{
+		"WARN retry attempt failed attempt=1 error=bah next_delay=1s",
+		"WARN retry attempt failed attempt=2 error=bah next_delay=2s",
+		"WARN retry attempt failed attempt=3 error=bah next_delay=0s",
+		"ERROR retry failed attempts=3 error=attempt count exceeded: bah",
+	})
+}
+
+func (*slogSuite) TestLogsMaxDelayLessThanDelay(c *gc.C) {
+	handler := &recordingHandler{}
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return nil },
+		Attempts: 3,
+		Delay:    time.Minute,
+		MaxDelay: time.Second,
+		Clock:    &mockClock{},
+		Logger:   slog.New(handler),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(handler.records, jc.DeepEquals, []string{
+		"WARN retry MaxDelay less than Delay max_delay=1s delay=1m0s",
+		"INFO retry succeeded attempts=1",
+	})
+}
+
+type contextKey struct{}
+
+func (*slogSuite) TestLogsWithContext(c *gc.C) {
+	handler := &recordingHandler{}
+	ctx := context.WithValue(context.Background(), contextKey{}, "request-1")
+	err := retry.Call(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 2,
+		Delay:    time.Second,
+		Clock:    &mockClock{},
+		Context:  ctx,
+		Logger:   slog.New(handler),
+	})
+	c.Assert(retry.IsAttemptsExceeded(errors.Cause(err)), jc.IsTrue)
+	c.Assert(handler.contexts, gc.HasLen, 3)
+	for _, logged := range handler.contexts {
+		c.Check(logged.Value(contextKey{}), gc.Equals, "request-1")
+	}
+}
+
+func (*slogSuite) TestLogsSuccess(c *gc.C) {
+	handler := &recordingHandler{}
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			if count == 1 {
+				return errors.New("bah")
+			}
+			return nil
+		},
+		Attempts: 3,
+		Delay:    time.Second,
+		Clock:    &mockClock{},
+		Logger:   slog.New(handler),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(handler.records, jc.DeepEquals, []string{
+		"WARN retry attempt failed attempt=1 error=bah next_delay=1s",
+		"INFO retry succeeded attempts=2",
+	})
+}
+
+func (*slogSuite) TestLogsFatalError(c *gc.C) {
+	handler := &recordingHandler{}
+	err := retry.Call(retry.CallArgs{
+		Func:         func() error { return errors.New("fatal") },
+		IsFatalError: func(error) bool { return true },
+		Attempts:     3,
+		Delay:        time.Second,
+		Clock:        &mockClock{},
+		Logger:       slog.New(handler),
+	})
+	c.Assert(err, gc.ErrorMatches, "fatal")
+	c.Assert(handler.records, jc.DeepEquals, []string{
+		"ERROR retry failed attempts=1 error=fatal",
+	})
+}
+
+func (*slogSuite) TestBuilder(c *gc.C) {
+	logger := slog.New(&recordingHandler{})
+	args, err := retry.New().
+		Func(func() error { return nil }).
+		Attempts(1).
+		Delay(time.Second).
+		Logger(logger).
+		Build()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(args.Logger, gc.Equals, logger)
+}
@@ -0,0 +1,43 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"time"
+)
+
+// State describes the retry loop after a failed attempt, as passed to the
+// NotifyFuncWithState. It is a snapshot taken when the function is called,
+// not a live view of the loop, so changing it has no effect, and it does
+// not change as the loop carries on. More fields may be added.
+type State struct {
+	// Attempt is the number of the attempt that failed, starting at 1.
+	Attempt int
+
+	// Err is the error returned from the attempt.
+	Err error
+
+	// Delay is the current delay from the backoff, before the jitter,
+	// DelayFunc, RetryAfter and other limits have been applied to it. If
+	// the loop will retry, it is the delay that the next wait is based on,
+	// otherwise it is the delay that the wait before the attempt was based
+	// on, which is the Delay for the first attempt.
+	Delay time.Duration
+
+	// NextDelay is how long the loop will wait before the next attempt. It
+	// is zero if WillRetry is false.
+	NextDelay time.Duration
+
+	// Elapsed is the time since Call was called, including any
+	// InitialDelay, up to the end of the attempt.
+	Elapsed time.Duration
+
+	// WillRetry is true if there is going to be another attempt, as for
+	// NotifyFuncV2.
+	WillRetry bool
+
+	// SameAsPrevious is true if the error is the same as the one from the
+	// previous attempt, as for NotifyFuncV2.
+	SameAsPrevious bool
+}
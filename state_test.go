@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type stateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&stateSuite{})
+
+func (*stateSuite) TestNotifyFuncWithState(c *gc.C) {
+	funcErr := errors.New("bah")
+	var states []retry.State
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return funcErr },
+		NotifyFuncWithState: func(state retry.State) {
+			states = append(states, state)
+		},
+		Attempts:      3,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		InitialDelay:  time.Minute,
+		Clock:         &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(states, jc.DeepEquals, []retry.State{{
+		Attempt:   1,
+		Err:       funcErr,
+		Delay:     time.Second,
+		NextDelay: time.Second,
+		Elapsed:   time.Minute,
+		WillRetry: true,
+	}, {
+		Attempt:        2,
+		Err:            funcErr,
+		Delay:          2 * time.Second,
+		NextDelay:      2 * time.Second,
+		Elapsed:        time.Minute + time.Second,
+		WillRetry:      true,
+		SameAsPrevious: true,
+	}, {
+		Attempt:        3,
+		Err:            funcErr,
+		Delay:          2 * time.Second,
+		Elapsed:        time.Minute + 3*time.Second,
+		SameAsPrevious: true,
+	}})
+}
+
+func (*stateSuite) TestNotifyFuncWithStateFatal(c *gc.C) {
+	var states []retry.State
+	err := retry.Call(retry.CallArgs{
+		Func:         func() error { return errors.New("bah") },
+		IsFatalError: func(error) bool { return true },
+		NotifyFuncWithState: func(state retry.State) {
+			states = append(states, state)
+		},
+		Attempts: 3,
+		Delay:    time.Second,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, gc.ErrorMatches, `bah`)
+	c.Assert(states, gc.HasLen, 1)
+	c.Assert(states[0].Attempt, gc.Equals, 1)
+	c.Assert(states[0].WillRetry, jc.IsFalse)
+	c.Assert(states[0].Delay, gc.Equals, time.Second)
+	c.Assert(states[0].NextDelay, gc.Equals, time.Duration(0))
+}
+
+func (*stateSuite) TestStateIsSnapshot(c *gc.C) {
+	var delays []time.Duration
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		NotifyFuncWithState: func(state retry.State) {
+			delays = append(delays, state.NextDelay)
+			// Changing the State has no effect on the loop.
+			state.NextDelay = time.Hour
+			state.Delay = time.Hour
+		},
+		Attempts:      3,
+		Delay:         time.Second,
+		BackoffFactor: 2,
+		Clock:         &mockClock{},
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(delays, jc.DeepEquals, []time.Duration{time.Second, 2 * time.Second, 0})
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Status describes how a retry loop ended.
+type Status int
+
+const (
+	// StatusSucceeded means that the Func returned a nil error.
+	StatusSucceeded Status = iota
+	// StatusFailed means that the Func returned an error that was fatal,
+	// according to IsFatalError or IsRetryableError.
+	StatusFailed
+	// StatusAttemptsExceeded means that every attempt failed.
+	StatusAttemptsExceeded
+	// StatusDurationExceeded means that the MaxDuration would have been
+	// exceeded by waiting for the next attempt.
+	StatusDurationExceeded
+	// StatusBudgetExhausted means that the Budget had no retries left.
+	StatusBudgetExhausted
+	// StatusStopped means that the Stop channel was closed, or ShouldRetry
+	// returned false.
+	StatusStopped
+	// StatusCancelled means that the Context was done.
+	StatusCancelled
+	// StatusNotValid means that the CallArgs were not valid, so the Func was
+	// not called.
+	StatusNotValid
+	// StatusRepeatedError means that the Func returned the same error
+	// MaxConsecutiveSameError times in a row.
+	StatusRepeatedError
+)
+
+var statusNames = map[Status]string{
+	StatusSucceeded:        "succeeded",
+	StatusFailed:           "failed",
+	StatusAttemptsExceeded: "attempts exceeded",
+	StatusDurationExceeded: "duration exceeded",
+	StatusBudgetExhausted:  "budget exhausted",
+	StatusStopped:          "stopped",
+	StatusCancelled:        "cancelled",
+	StatusNotValid:         "not valid",
+	StatusRepeatedError:    "repeated error",
+}
+
+// String returns a description of the status.
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Stats describes what happened during a retry loop. All the times are
+// measured with the Clock of the CallArgs.
+type Stats struct {
+	// Attempts is the number of times the Func was called.
+	Attempts int
+
+	// Elapsed is the total time spent in the retry loop.
+	Elapsed time.Duration
+
+	// SleepTime is the time spent waiting, including the InitialDelay and
+	// the delays between attempts.
+	SleepTime time.Duration
+
+	// FuncTime is the time spent calling the Func. An attempt that timed
+	// out counts for the AttemptTimeout, even if the Func is still running.
+	FuncTime time.Duration
+
+	// Status describes how the loop ended.
+	Status Status
+}
+
+// CallStats behaves the same as Call, and also returns the Stats of the
+// retry loop. The Stats are filled in whether or not the Func succeeds.
+func CallStats(args CallArgs) (Stats, error) {
+	var stats Stats
+	// The Clock is only known once the defaults have been applied.
+	validated, err := args.validated()
+	if err != nil {
+		stats.Status = StatusNotValid
+		return stats, errors.Trace(err)
+	}
+	args.stats = &stats
+	start := validated.Clock.Now()
+	attempts, err := args.run()
+	stats.Attempts = attempts
+	stats.Elapsed = validated.Clock.Now().Sub(start)
+	stats.Status = statusOf(attempts, err)
+	return stats, args.single(err)
+}
+
+// statusOf returns the status of a retry loop that made the attempts and
+// returned the error. A NotValid error before any attempt comes from the
+// CallArgs, rather than from the Func.
+func statusOf(attempts int, err error) Status {
+	cause := errors.Cause(err)
+	switch {
+	case err == nil:
+		return StatusSucceeded
+	case attempts == 0 && errors.IsNotValid(cause):
+		return StatusNotValid
+	case IsAttemptsExceeded(cause):
+		return StatusAttemptsExceeded
+	case IsDurationExceeded(cause):
+		return StatusDurationExceeded
+	case IsRepeatedError(err):
+		return StatusRepeatedError
+	case IsBudgetExhausted(err):
+		return StatusBudgetExhausted
+	case IsRetryStopped(err):
+		return StatusStopped
+	case IsRetryCancelled(err):
+		return StatusCancelled
+	}
+	return StatusFailed
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type statsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&statsSuite{})
+
+func (*statsSuite) TestSucceeded(c *gc.C) {
+	clock := &mockClock{}
+	count := 0
+	stats, err := retry.CallStats(retry.CallArgs{
+		Func: func() error {
+			clock.now = clock.now.Add(time.Second)
+			count++
+			if count < 3 {
+				return errors.New("bah")
+			}
+			return nil
+		},
+		Attempts:      5,
+		Delay:         time.Minute,
+		BackoffFactor: 2,
+		InitialDelay:  10 * time.Second,
+		Clock:         clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(stats, jc.DeepEquals, retry.Stats{
+		Attempts:  3,
+		Elapsed:   3*time.Minute + 13*time.Second,
+		SleepTime: 3*time.Minute + 10*time.Second,
+		FuncTime:  3 * time.Second,
+		Status:    retry.StatusSucceeded,
+	})
+}
+
+func (*statsSuite) TestAttemptsExceeded(c *gc.C) {
+	clock := &mockClock{}
+	stats, err := retry.CallStats(retry.CallArgs{
+		Func: func() error {
+			clock.now = clock.now.Add(time.Second)
+			return errors.New("bah")
+		},
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(stats, jc.DeepEquals, retry.Stats{
+		Attempts:  3,
+		Elapsed:   2*time.Minute + 3*time.Second,
+		SleepTime: 2 * time.Minute,
+		FuncTime:  3 * time.Second,
+		Status:    retry.StatusAttemptsExceeded,
+	})
+	c.Assert(stats.Status.String(), gc.Equals, "attempts exceeded")
+}
+
+func (*statsSuite) TestSingleAttempt(c *gc.C) {
+	stats, err := retry.CallStats(retry.CallArgs{
+		Func:     func() error { return errors.New("bah") },
+		Attempts: 1,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	})
+	// Like Call, CallStats returns the bare error, but the status says the
+	// attempts were used up.
+	c.Assert(err, gc.ErrorMatches, "bah")
+	c.Assert(errors.Cause(err), gc.Not(jc.Satisfies), retry.IsAttemptsExceeded)
+	c.Assert(stats.Attempts, gc.Equals, 1)
+	c.Assert(stats.Status, gc.Equals, retry.StatusAttemptsExceeded)
+}
+
+func (*statsSuite) TestStatus(c *gc.C) {
+	closed := make(chan struct{})
+	close(closed)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i, test := range []struct {
+		about  string
+		args   retry.CallArgs
+		status retry.Status
+	}{{
+		about: "fatal",
+		args: retry.CallArgs{
+			IsFatalError: func(error) bool { return true },
+			Attempts:     3,
+		},
+		status: retry.StatusFailed,
+	}, {
+		about: "duration exceeded",
+		args: retry.CallArgs{
+			Attempts:    3,
+			MaxDuration: time.Second,
+		},
+		status: retry.StatusDurationExceeded,
+	}, {
+		about: "budget exhausted",
+		args: retry.CallArgs{
+			Attempts: 3,
+			Budget:   retry.NewBudget(1, 0),
+		},
+		status: retry.StatusBudgetExhausted,
+	}, {
+		about: "stopped",
+		args: retry.CallArgs{
+			Attempts: 3,
+			Stop:     closed,
+		},
+		status: retry.StatusStopped,
+	}, {
+		about: "should not retry",
+		args: retry.CallArgs{
+			Attempts:    3,
+			ShouldRetry: func(error, int) bool { return false },
+		},
+		status: retry.StatusStopped,
+	}, {
+		about: "cancelled",
+		args: retry.CallArgs{
+			Attempts: 3,
+			Context:  cancelled,
+		},
+		status: retry.StatusCancelled,
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		args := test.args
+		args.Func = func() error { return errors.New("bah") }
+		args.Delay = time.Minute
+		args.Clock = &mockClock{}
+		stats, err := retry.CallStats(args)
+		c.Check(err, gc.NotNil)
+		c.Check(stats.Status, gc.Equals, test.status)
+	}
+}
+
+func (*statsSuite) TestNotValid(c *gc.C) {
+	stats, err := retry.CallStats(retry.CallArgs{
+		Attempts: 3,
+		Delay:    time.Minute,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(stats, jc.DeepEquals, retry.Stats{Status: retry.StatusNotValid})
+}
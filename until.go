@@ -0,0 +1,62 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"github.com/juju/errors"
+)
+
+// ErrConditionNotMet is the error used for an attempt of Until when the
+// condition returned false, and for an attempt of CallReturning when the
+// RetryIfResult returned true. If the loop gives up, this is the LastError
+// of the error returned.
+var ErrConditionNotMet = errors.New("condition not met")
+
+// Until retries until the condition returns true, such as when waiting for
+// a resource to become ready. If the condition returns true with a nil
+// error, Until returns nil. If it returns false with a nil error, it is
+// retried, as an attempt that failed with ErrConditionNotMet. If it returns
+// an error, the error is handled in the same way as an error from Func,
+// using IsFatalError and IsRetryableError. The Func, FuncWithAttempt and
+// FuncCtx of the args are ignored.
+//
+// ErrConditionNotMet is passed to the NotifyFunc and other callbacks like
+// any other error, but is never treated as fatal, so the IsFatalError and
+// IsRetryableError need only consider the errors from the condition.
+func Until(args CallArgs, condition func() (bool, error)) error {
+	args.Func = func() error {
+		done, err := condition()
+		if err != nil {
+			return err
+		}
+		if !done {
+			return ErrConditionNotMet
+		}
+		return nil
+	}
+	args.FuncWithAttempt = nil
+	args.FuncCtx = nil
+	args.retryConditionNotMet()
+	return errors.Trace(Call(args))
+}
+
+// retryConditionNotMet wraps the IsFatalError, IsFatalErrorWithAttempt and
+// IsRetryableError so that ErrConditionNotMet is always retried.
+func (args *CallArgs) retryConditionNotMet() {
+	if isFatal := args.IsFatalError; isFatal != nil {
+		args.IsFatalError = func(err error) bool {
+			return err != ErrConditionNotMet && isFatal(err)
+		}
+	}
+	if isFatal := args.IsFatalErrorWithAttempt; isFatal != nil {
+		args.IsFatalErrorWithAttempt = func(err error, attempt int) bool {
+			return err != ErrConditionNotMet && isFatal(err, attempt)
+		}
+	}
+	if isRetryable := args.IsRetryableError; isRetryable != nil {
+		args.IsRetryableError = func(err error) bool {
+			return err == ErrConditionNotMet || isRetryable(err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type untilSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&untilSuite{})
+
+func (*untilSuite) TestConditionMet(c *gc.C) {
+	clock := &mockClock{}
+	count := 0
+	err := retry.Until(retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    clock,
+	}, func() (bool, error) {
+		count++
+		return count == 3, nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 3)
+	c.Assert(clock.delays, gc.HasLen, 2)
+}
+
+func (*untilSuite) TestConditionNotMet(c *gc.C) {
+	err := retry.Until(retry.CallArgs{
+		Attempts: 3,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	}, func() (bool, error) {
+		return false, nil
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(err, gc.ErrorMatches, `attempt count exceeded: condition not met`)
+	c.Assert(errors.Cause(err).(*retry.AttemptsExceeded).LastError, gc.Equals, retry.ErrConditionNotMet)
+}
+
+func (*untilSuite) TestRetryableError(c *gc.C) {
+	count := 0
+	err := retry.Until(retry.CallArgs{
+		Attempts: 5,
+		Delay:    time.Minute,
+		Clock:    &mockClock{},
+	}, func() (bool, error) {
+		count++
+		if count == 1 {
+			return false, errors.New("bah")
+		}
+		return true, nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(count, gc.Equals, 2)
+}
+
+func (*untilSuite) TestFatalError(c *gc.C) {
+	fatal := errors.New("fatal")
+	count := 0
+	err := retry.Until(retry.CallArgs{
+		// Everything is fatal, except that a condition that is not
+		// met is still retried.
+		IsFatalError: func(error) bool { return true },
+		Attempts:     5,
+		Delay:        time.Minute,
+		Clock:        &mockClock{},
+	}, func() (bool, error) {
+		count++
+		if count < 3 {
+			return false, nil
+		}
+		return false, fatal
+	})
+	c.Assert(errors.Cause(err), gc.Equals, fatal)
+	c.Assert(count, gc.Equals, 3)
+}
+
+func (*untilSuite) TestIsRetryableError(c *gc.C) {
+	count := 0
+	err := retry.Until(retry.CallArgs{
+		IsRetryableError: func(error) bool { return false },
+		Attempts:         5,
+		Delay:            time.Minute,
+		Clock:            &mockClock{},
+	}, func() (bool, error) {
+		count++
+		if count < 3 {
+			return false, nil
+		}
+		return false, errors.New("not retryable")
+	})
+	c.Assert(err, gc.ErrorMatches, "not retryable")
+	c.Assert(count, gc.Equals, 3)
+}
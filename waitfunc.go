@@ -0,0 +1,71 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+)
+
+// validateWaitFunc checks that nothing else that decides how long to wait
+// between attempts is set along with the WaitFunc.
+func (args *CallArgs) validateWaitFunc() error {
+	if args.WaitFunc == nil {
+		return nil
+	}
+	switch {
+	case args.Delay != 0:
+		return errors.NotValidf("WaitFunc with Delay")
+	case len(args.Schedule) > 0:
+		return errors.NotValidf("WaitFunc with Schedule")
+	case args.BackoffFunc != nil:
+		return errors.NotValidf("WaitFunc with BackoffFunc")
+	case args.MinInterval != 0:
+		return errors.NotValidf("WaitFunc with MinInterval")
+	}
+	return nil
+}
+
+// waitFor calls the WaitFunc, with a context that is cancelled if the Stop
+// channel is closed, the Canceller is done or the Context is done. If the
+// loop has already been stopped, the WaitFunc is not called at all. An
+// error from the WaitFunc once the loop has been stopped is reported as the
+// loop being stopped, rather than as the error.
+func (args *CallArgs) waitFor() (sleepResult, error) {
+	if args.stats != nil {
+		start := args.Clock.Now()
+		defer func() {
+			args.stats.SleepTime += args.Clock.Now().Sub(start)
+		}()
+	}
+	stop, cancelled, done := args.stopChannels()
+	if result := stopped(stop, cancelled, done); result != sleepCompleted {
+		return result, nil
+	}
+	ctx := args.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := args.withStop(ctx)
+	defer cancel()
+	err := args.WaitFunc(ctx)
+	if result := stopped(stop, cancelled, done); result != sleepCompleted {
+		return result, nil
+	}
+	return sleepCompleted, err
+}
+
+// stopped returns sleepStopped if the stop or cancelled channels are
+// closed, sleepCancelled if the done channel is closed, and sleepCompleted
+// otherwise.
+func stopped(stop, cancelled, done <-chan struct{}) sleepResult {
+	switch {
+	case isClosed(stop), isClosed(cancelled):
+		return sleepStopped
+	case isClosed(done):
+		return sleepCancelled
+	}
+	return sleepCompleted
+}
@@ -0,0 +1,161 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/retry"
+)
+
+type waitFuncSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&waitFuncSuite{})
+
+func (*waitFuncSuite) TestWaitFunc(c *gc.C) {
+	clock := &mockClock{}
+	count, waits := 0, 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			c.Check(waits, gc.Equals, count-1)
+			return errors.New("bah")
+		},
+		WaitFunc: func(ctx context.Context) error {
+			waits++
+			return ctx.Err()
+		},
+		Attempts: 3,
+		Clock:    clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	c.Assert(count, gc.Equals, 3)
+	c.Assert(waits, gc.Equals, 2)
+	// The WaitFunc is used instead of any delay.
+	c.Assert(clock.delays, gc.HasLen, 0)
+}
+
+func (*waitFuncSuite) TestWaitFuncIncludeFinalDelay(c *gc.C) {
+	clock := &mockClock{}
+	waits := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		WaitFunc: func(ctx context.Context) error {
+			waits++
+			return ctx.Err()
+		},
+		Attempts:          3,
+		IncludeFinalDelay: true,
+		Clock:             clock,
+	})
+	c.Assert(errors.Cause(err), jc.Satisfies, retry.IsAttemptsExceeded)
+	// The WaitFunc is called after the final attempt too.
+	c.Assert(waits, gc.Equals, 3)
+	c.Assert(clock.delays, gc.HasLen, 0)
+}
+
+func (*waitFuncSuite) TestWaitFuncError(c *gc.C) {
+	noTokens := errors.New("no tokens")
+	count := 0
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			count++
+			return errors.New("bah")
+		},
+		WaitFunc: func(context.Context) error { return noTokens },
+		Attempts: 3,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, gc.ErrorMatches, `waiting for next attempt: no tokens`)
+	c.Assert(errors.Cause(err), gc.Equals, noTokens)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (*waitFuncSuite) TestStopDuringWaitFunc(c *gc.C) {
+	stop := make(chan struct{})
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		WaitFunc: func(ctx context.Context) error {
+			close(stop)
+			// The context is cancelled by the Stop channel.
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Attempts: 3,
+		Stop:     stop,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+	c.Assert(err, gc.ErrorMatches, `retry stopped`)
+}
+
+func (*waitFuncSuite) TestContextDoneDuringWaitFunc(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := retry.Call(retry.CallArgs{
+		Func: func() error { return errors.New("bah") },
+		WaitFunc: func(ctx context.Context) error {
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Attempts: 3,
+		Context:  ctx,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryCancelled)
+}
+
+func (*waitFuncSuite) TestStoppedBeforeWaitFunc(c *gc.C) {
+	stop := make(chan struct{})
+	err := retry.Call(retry.CallArgs{
+		Func: func() error {
+			close(stop)
+			return errors.New("bah")
+		},
+		WaitFunc: func(context.Context) error {
+			c.Fatalf("WaitFunc called")
+			return nil
+		},
+		Attempts: 3,
+		Stop:     stop,
+		Clock:    &mockClock{},
+	})
+	c.Assert(err, jc.Satisfies, retry.IsRetryStopped)
+}
+
+func (*waitFuncSuite) TestWaitFuncNotValid(c *gc.C) {
+	for i, test := range []struct {
+		args retry.CallArgs
+		err  string
+	}{{
+		args: retry.CallArgs{Delay: time.Second},
+		err:  `WaitFunc with Delay not valid`,
+	}, {
+		args: retry.CallArgs{Schedule: []time.Duration{time.Second}},
+		err:  `WaitFunc with Schedule not valid`,
+	}, {
+		args: retry.CallArgs{BackoffFunc: retry.FibonacciBackoff(time.Second)},
+		err:  `WaitFunc with BackoffFunc not valid`,
+	}, {
+		args: retry.CallArgs{MinInterval: time.Second},
+		err:  `WaitFunc with MinInterval not valid`,
+	}} {
+		c.Logf("test %d", i)
+		test.args.Func = func() error { return nil }
+		test.args.WaitFunc = func(context.Context) error { return nil }
+		test.args.Attempts = 3
+		err := retry.Call(test.args)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}